@@ -0,0 +1,50 @@
+package command
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins/ansible"
+	"github.com/mitchellh/cli"
+)
+
+type AnsibleCommand struct {
+	Ui cli.Ui
+}
+
+func (c *AnsibleCommand) Run(args []string) int {
+	if len(args) == 0 || args[0] != "eject" {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	var dest string
+	var force bool
+	cmdFlags := flag.NewFlagSet("ansible eject", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&dest, "dest", "./playbook", "")
+	cmdFlags.BoolVar(&force, "force", false, "")
+	if err := cmdFlags.Parse(args[1:]); err != nil {
+		return 1
+	}
+	if err := ansible.Unpack(dest, force); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	c.Ui.Info(dest)
+	return 0
+}
+
+func (c *AnsibleCommand) Synopsis() string {
+	return "Manages the built-in ansible playbook"
+}
+func (c *AnsibleCommand) Help() string {
+	helpText := `
+Usage: hipops ansible eject [options]
+Writes the built-in ansible playbook and its roles out for customization.
+Run exec with -playbook-path pointing to them to use the copy.
+Options:
+	-dest="./playbook"         Directory to write the playbook to
+	-force=false               Overwrite existing files
+`
+	return strings.TrimSpace(helpText)
+}
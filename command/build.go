@@ -0,0 +1,98 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+// dockerCmd is the docker CLI that builds and pushes app images.
+var dockerCmd = "docker"
+
+// buildImages builds the image of every action's app that has a build
+// block, once per tag, and pushes it when push is set.
+func buildImages(actions []*plugins.Action, push bool) error {
+	built := map[string]bool{}
+	for _, a := range actions {
+		b := a.Build
+		if b == nil || built[b.Tag] {
+			continue
+		}
+		built[b.Tag] = true
+		if err := utilities.RunCmd(dockerCmd, b.Params()...); err != nil {
+			return fmt.Errorf("%s: building %s: %s", a.Name, b.Tag, err)
+		}
+		if !push {
+			continue
+		}
+		if r := a.Registry; r != nil {
+			if err := login(r); err != nil {
+				return fmt.Errorf("%s: registry %s: %s", a.Name, r.Server, err)
+			}
+		}
+		if err := utilities.RunCmd(dockerCmd, "push", b.Tag); err != nil {
+			return fmt.Errorf("%s: pushing %s: %s", a.Name, b.Tag, err)
+		}
+	}
+	return nil
+}
+
+// login logs the local docker CLI in to the registry before a push.
+func login(r *plugins.Registry) error {
+	if err := r.Resolve(); err != nil {
+		return err
+	}
+	cmd := exec.Command(dockerCmd, "login", "--username", r.Username, "--password-stdin", r.Server)
+	cmd.Stdin = strings.NewReader(string(r.Password))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+type BuildCommand struct {
+	Ui     cli.Ui
+	params params
+}
+
+func (c *BuildCommand) Run(args []string) int {
+	var push bool
+	cmdFlags := flag.NewFlagSet("build", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	cmdFlags.BoolVar(&push, "push", true, "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	scenario, actions, err := c.params.loadScenario(&plugins.Passthrough)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer scenario.Workspace.Remove()
+	if err = buildImages(actions, push); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
+
+func (c *BuildCommand) Synopsis() string {
+	return "Builds and pushes the app images of a JSON scenerio"
+}
+func (c *BuildCommand) Help() string {
+	helpText := `
+Usage: hipops build [options]
+Builds the image of every app with a build block using the local docker
+CLI and pushes it to its registry
+Options:
+	-config="./config.json"    hipops JSON configuration
+	-push=true                 Push the images after building them
+`
+	return strings.TrimSpace(helpText)
+}
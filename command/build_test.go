@@ -0,0 +1,58 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+const buildConfig = `{
+  "id": "demo", "env": "dev", "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [{"name": "api", "type": "web", "build": {
+    "context": "api", "dockerfile": "Dockerfile.prod",
+    "args": {"VERSION": "1.2", "GOOS": "linux"},
+    "tag": "registry.local/{{.App.Name}}:{{.Env}}"
+  }}],
+  "playbooks": [{
+    "inventory": "web",
+    "apps": ["{{index .Apps 0}}", "{{index .Apps 0}}"],
+    "containers": [{"params": "-d {{.App.Image}}"}]
+  }]
+}`
+
+func TestBuildCommandRun(t *testing.T) {
+	spec := utilities.Spec(t)
+	var _ cli.Command = &BuildCommand{}
+
+	dir, _ := ioutil.TempDir("", "hipops-build")
+	defer os.RemoveAll(dir)
+	config, log := filepath.Join(dir, "config.json"), filepath.Join(dir, "docker.log")
+	ioutil.WriteFile(config, []byte(buildConfig), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\necho \"$@\" >> "+log+"\n"), 0700)
+	defer func(cmd string) { dockerCmd = cmd }(dockerCmd)
+	dockerCmd = filepath.Join(dir, "docker")
+
+	ui := new(cli.MockUi)
+	spec.Expect((&BuildCommand{Ui: ui}).Run([]string{"-config", config})).ToEqual(0)
+	content, _ := ioutil.ReadFile(log)
+	context := filepath.Join(dir, "api")
+	spec.Expect(string(content)).ToEqual("build -t registry.local/demo-web-api:dev -f " + filepath.Join(context, "Dockerfile.prod") +
+		" --build-arg GOOS=linux --build-arg VERSION=1.2 " + context + "\npush registry.local/demo-web-api:dev\n")
+
+	os.Remove(log)
+	spec.Expect((&BuildCommand{Ui: ui}).Run([]string{"-config", config, "-push=false"})).ToEqual(0)
+	content, _ = ioutil.ReadFile(log)
+	spec.ExpectString(string(content)).ToContain("build -t registry.local/demo-web-api:dev")
+	spec.Expect(strings.Contains(string(content), "push")).ToEqual(false)
+
+	ui = new(cli.MockUi)
+	spec.Expect((&PlanCommand{Ui: ui}).Run([]string{"-config", config})).ToEqual(1)
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("  build registry.local/demo-web-api:dev from " + context + "\n")
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("-d registry.local/demo-web-api:dev")
+}
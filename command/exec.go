@@ -1,32 +1,68 @@
 package command
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/aminjam/hipops/parser"
 	"github.com/aminjam/hipops/plugins"
 	"github.com/aminjam/hipops/plugins/ansible"
+	"github.com/aminjam/hipops/plugins/docker"
+	"github.com/aminjam/hipops/plugins/external"
+	"github.com/aminjam/hipops/plugins/script"
+	"github.com/aminjam/hipops/plugins/ssh"
 	"github.com/aminjam/hipops/utilities"
 	"github.com/mitchellh/cli"
 )
 
-var myPlugins []*plugins.Plugin
+var myPlugins map[string]*plugins.Plugin
+
+func findPlugin(name string) (*plugins.Plugin, error) {
+	if plugin, ok := myPlugins[name]; ok {
+		return plugin, nil
+	}
+	plugin, err := external.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
 
 type params struct {
 	baseDir, config, gitKey, plugin,
 	privateKey, trigger string
 	debug int
+	json  bool
+
+	//run workspace
+	workdir     string
+	keepWorkdir bool
+	offline     bool
+	build       bool
+
+	//hipops.lock
+	locked, ignoreLock bool
 
 	//ansible plugin
 	inventory, playbookPath string
+	ansible                 plugins.AnsibleOptions
+	ansibleArgs             string
+
+	//docker plugin
+	dockerHost string
+
+	//ssh plugin
+	knownHosts string
+
+	//script plugin
+	scriptDir string
 }
 
 func (p *params) toAction(a *plugins.Action) error {
-	if a.Repository != nil && p.gitKey != "" {
+	if a.Repository != nil && a.Repository.DeployKey == "" && a.Repository.IsSsh() && p.gitKey != "" {
 		a.Repository.SshKey = p.gitKey
 	}
 	p.playbookPath = strings.TrimSuffix(p.playbookPath, "/")
@@ -34,6 +70,13 @@ func (p *params) toAction(a *plugins.Action) error {
 		a.Play = fmt.Sprintf("%s/%s", p.playbookPath, a.Play)
 	}
 	a.InventoryFile = p.inventory
+	args, err := plugins.SplitParams(p.ansibleArgs)
+	if err != nil {
+		return err
+	}
+	options := p.ansible
+	options.Args = args
+	a.Ansible = a.Ansible.Merge(&options)
 	a.PrivateKey = p.privateKey
 	a.Debug = p.debug
 	baseDir := filepath.Dir(p.config)
@@ -45,6 +88,67 @@ func (p *params) toAction(a *plugins.Action) error {
 	return nil
 }
 
+// pluginFlags adds the flags of the built-in plugins.
+func (p *params) pluginFlags(cmdFlags *flag.FlagSet) {
+	//ansible plugin flags
+	cmdFlags.StringVar(&p.inventory, "inventory", "./hosts/local", "")
+	cmdFlags.StringVar(&p.playbookPath, "playbook-path", "", "")
+	cmdFlags.StringVar(&p.ansible.Limit, "limit", "", "")
+	cmdFlags.StringVar(&p.ansible.Tags, "tags", "", "")
+	cmdFlags.StringVar(&p.ansible.SkipTags, "skip-tags", "", "")
+	cmdFlags.IntVar(&p.ansible.Forks, "forks", 0, "")
+	cmdFlags.BoolVar(&p.ansible.Check, "check", false, "")
+	cmdFlags.BoolVar(&p.ansible.Diff, "diff", false, "")
+	cmdFlags.BoolVar(&p.ansible.Become, "become", false, "")
+	cmdFlags.StringVar(&p.ansible.VaultPasswordFile, "vault-password-file", "", "")
+	cmdFlags.StringVar(&p.ansible.SshCommonArgs, "ssh-common-args", "", "")
+	cmdFlags.StringVar(&p.ansibleArgs, "ansible-args", "", "")
+
+	//docker plugin flags
+	cmdFlags.StringVar(&p.dockerHost, "docker-host", os.Getenv("DOCKER_HOST"), "")
+
+	//ssh plugin flags
+	cmdFlags.StringVar(&p.knownHosts, "known-hosts", "~/.ssh/known_hosts", "")
+
+	//script plugin flags
+	cmdFlags.StringVar(&p.scriptDir, "script-dir", "./hipops-scripts", "")
+}
+
+// validatePlugin finds the plugin named by -plugin and validates its
+// flags. External plugins get the arguments left after the flags.
+func (p *params) validatePlugin(args []string) (*plugins.Plugin, error) {
+	plugin, err := findPlugin(p.plugin)
+	if err != nil {
+		return nil, err
+	}
+	switch p.plugin {
+	case "ansible":
+		err = (*plugin).ValidateParams(p.inventory, p.playbookPath)
+	case "docker":
+		err = (*plugin).ValidateParams(p.dockerHost)
+	case "script":
+		err = (*plugin).ValidateParams(p.scriptDir)
+	case "ssh":
+		err = (*plugin).ValidateParams(p.inventory, p.privateKey, p.knownHosts)
+	default:
+		err = (*plugin).ValidateParams(args...)
+	}
+	return plugin, err
+}
+
+// resolveRegistries reads the password of every registry the actions log
+// in to.
+func resolveRegistries(actions []*plugins.Action) error {
+	for _, a := range actions {
+		if r := a.Registry; r != nil {
+			if err := r.Resolve(); err != nil {
+				return fmt.Errorf("%s: %s", a.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
 type ExecCommand struct {
 	ShutdownCh <-chan struct{}
 	Ui         cli.Ui
@@ -62,11 +166,13 @@ func (c *ExecCommand) Run(args []string) int {
 	cmdFlags.StringVar(&c.params.plugin, "plugin", "", "")
 	cmdFlags.StringVar(&c.params.privateKey, "private-key", "", "")
 	cmdFlags.StringVar(&c.params.trigger, "trigger", "", "")
-
-	//ansible plugin flags
-	cmdFlags.StringVar(&c.params.inventory, "inventory", "./hosts/local", "")
-	cmdFlags.StringVar(&c.params.playbookPath, "playbook-path", "", "")
-
+	cmdFlags.BoolVar(&c.params.json, "json", false, "")
+	cmdFlags.StringVar(&c.params.workdir, "workdir", "", "")
+	cmdFlags.BoolVar(&c.params.keepWorkdir, "keep-workdir", false, "")
+	cmdFlags.BoolVar(&c.params.offline, "offline", false, "")
+	cmdFlags.BoolVar(&c.params.build, "build", false, "")
+	cmdFlags.BoolVar(&c.params.locked, "locked", false, "")
+	c.params.pluginFlags(cmdFlags)
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
@@ -78,36 +184,97 @@ func (c *ExecCommand) Run(args []string) int {
 		c.Ui.Error(c.Help())
 		return 1
 	}
-	plugin := myPlugins[0]
-	switch c.params.plugin {
-	case "ansible":
-		err := (*plugin).ValidateParams(c.params.inventory, c.params.playbookPath)
-		utilities.CheckErr(err)
-	}
-	config, err := ioutil.ReadFile(c.params.config)
+	plugin, err := c.params.validatePlugin(cmdFlags.Args())
 	utilities.CheckErr(err)
-
-	var scenario parser.Scenario
-	err = scenario.Configure(config)
+	scenario, actions, err := c.params.loadScenario(plugin)
 	utilities.CheckErr(err)
-	utilities.CleanupTempFiles(scenario.Suffix)
+	defer scenario.Workspace.Remove()
+	go func() {
+		<-c.ShutdownCh
+		scenario.Workspace.Remove()
+		os.Exit(1)
+	}()
+	// generated scripts read the registry password on their hosts
+	if c.params.plugin != "script" {
+		if err = resolveRegistries(actions); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+	if c.params.build {
+		if err = buildImages(actions, true); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
 
-	actions, err := scenario.Parse(plugin)
-	utilities.CheckErr(err)
+	outcomes := []*outcome{}
 	for _, a := range actions {
 		if c.params.trigger == "" || a.State() == utilities.DEFAULT_APP_STATE || (c.params.trigger != "" && strings.HasSuffix(a.Name, c.params.trigger)) {
-			err = c.params.toAction(a)
-			utilities.CheckErr(err)
-			err = (*plugin).Run(a)
-			utilities.CheckErr(err)
+			if err = ship(a, scenario.Workspace); err == nil {
+				err = (*plugin).Run(a)
+			}
+			outcomes = append(outcomes, newOutcome(a, err))
+			if err != nil {
+				break
+			}
 		}
 	}
+	c.summarize(outcomes)
+
+	if c.params.json {
+		content, err := json.MarshalIndent(outcomes, "", "  ")
+		utilities.CheckErr(err)
+		c.Ui.Output(string(content))
+	}
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
 
 	c.Ui.Info(scenario.Id)
 
 	return 0
 }
 
+// outcome is the result of running one action, as printed by -json.
+type outcome struct {
+	Name   string          `json:"name"`
+	State  string          `json:"state"`
+	Error  string          `json:"error,omitempty"`
+	Result *plugins.Result `json:"result,omitempty"`
+}
+
+func newOutcome(a *plugins.Action, err error) *outcome {
+	o := &outcome{Name: a.Name, State: a.State(), Result: a.Result}
+	if err != nil {
+		o.Error = err.Error()
+	}
+	return o
+}
+
+func (c *ExecCommand) summarize(outcomes []*outcome) {
+	for _, o := range outcomes {
+		if o.Result == nil {
+			continue
+		}
+		for _, h := range o.Result.Hosts {
+			line := fmt.Sprintf("%s %s: %s", o.Name, h.Name, h.Status)
+			if h.Status == plugins.STATUS_FAILED || h.Status == plugins.STATUS_UNREACHABLE {
+				for _, t := range h.Tasks {
+					if t.Status == h.Status {
+						line += fmt.Sprintf(" (%s: %s)", t.Name, t.Msg)
+						break
+					}
+				}
+				c.Ui.Error(line)
+				continue
+			}
+			c.Ui.Info(line)
+		}
+	}
+}
+
 func (c *ExecCommand) Synopsis() string {
 	return "Executes a JSON scenerio with a plugin"
 }
@@ -120,16 +287,48 @@ Options:
 	-debug=0                   debug level (0-3)
 	-git-key="~/.ssh/id_rsa"   SSH Git Key for Repo
 	-plugin=""                 Name of the plugin (e.g. ansible)
+	                           Other names run hipops-plugin-<name> from PATH
+	                           with the remaining arguments
 	-private-key=""            SSH Host Private Key
 	-trigger=""                Name of the app to trigger
+	-json=false                Print the outcome of every action as JSON
+	-workdir=""                Directory for the run workspace (default $TMPDIR)
+	-keep-workdir=false        Keep the run workspace after the run
+	-offline=false             Use only customizations in the download cache
+	-build=false               Build and push the app images before deploying
+	-locked=false              Fail unless hipops.lock pins every image and repository
 
 	(ansible plugin)
-	-inventory="./hosts/local"     Inventory Hosts Target
-	-playbook-path=""              Ansible Playbook Path (Optional)
+	-inventory="./hosts/local"     Inventory Hosts Target (also used by ssh)
+	-playbook-path=""              Ansible Playbook Path (default built-in playbook)
+	-limit=""                      Passed to ansible-playbook as --limit
+	-tags=""                       Passed to ansible-playbook as --tags
+	-skip-tags=""                  Passed to ansible-playbook as --skip-tags
+	-forks=0                       Passed to ansible-playbook as --forks
+	-check=false                   Passed to ansible-playbook as --check
+	-diff=false                    Passed to ansible-playbook as --diff
+	-become=false                  Passed to ansible-playbook as --become
+	-vault-password-file=""        Passed to ansible-playbook as --vault-password-file
+	-ssh-common-args=""            Passed to ansible-playbook as --ssh-common-args
+	-ansible-args=""               Any other ansible-playbook arguments
+
+	(docker plugin)
+	-docker-host=$DOCKER_HOST      Docker Engine API (default unix:///var/run/docker.sock)
+
+	(ssh plugin)
+	-known-hosts="~/.ssh/known_hosts"  Host keys to verify, empty to skip checking
+
+	(script plugin)
+	-script-dir="./hipops-scripts"     Directory to write one script per inventory group
 `
 	return strings.TrimSpace(helpText)
 }
 
 func init() {
-	myPlugins = []*plugins.Plugin{&ansible.Instance}
+	myPlugins = map[string]*plugins.Plugin{
+		"ansible": &ansible.Instance,
+		"docker":  &docker.Instance,
+		"script":  &script.Instance,
+		"ssh":     &ssh.Instance,
+	}
 }
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aminjam/hipops/export"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+type ExportCommand struct {
+	Ui     cli.Ui
+	params params
+	out    string
+}
+
+func (c *ExportCommand) Run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	exporter, ok := export.Exporters[args[0]]
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("Unknown export format %s, expected one of %s", args[0], strings.Join(export.Names(), ", ")))
+		return 1
+	}
+	cmdFlags := flag.NewFlagSet("export", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	cmdFlags.StringVar(&c.out, "out", "", "")
+	if err := cmdFlags.Parse(args[1:]); err != nil {
+		return 1
+	}
+
+	scenario, actions, err := c.params.loadScenario(&plugins.Passthrough)
+	utilities.CheckErr(err)
+	defer scenario.Workspace.Remove()
+
+	files, warnings, err := exporter.Export(scenario, actions)
+	utilities.CheckErr(err)
+	for _, w := range warnings {
+		c.Ui.Warn(w)
+	}
+	for _, f := range files {
+		if c.out == "" {
+			if f.Support {
+				c.Ui.Warn(fmt.Sprintf("%s is only written with -out", f.Name))
+				continue
+			}
+			c.Ui.Output(string(f.Content))
+			continue
+		}
+		fileName := filepath.Join(c.out, f.Name)
+		err = os.MkdirAll(filepath.Dir(fileName), 0755)
+		utilities.CheckErr(err)
+		mode := os.FileMode(0644)
+		if f.Support {
+			mode = 0600
+		}
+		err = ioutil.WriteFile(fileName, f.Content, mode)
+		utilities.CheckErr(err)
+		c.Ui.Info(fileName)
+	}
+	return 0
+}
+
+func (c *ExportCommand) Synopsis() string {
+	return "Exports a JSON scenerio to another format"
+}
+func (c *ExportCommand) Help() string {
+	helpText := `
+Usage: hipops export <format> [options]
+Exports a JSON scenerio to another format
+Formats:
+	compose       docker-compose.yml with a service per container
+	fleet         systemd units with [X-Fleet] sections for the inventory
+	kubernetes    kubernetes.yml with a Deployment and Service per app
+	systemd       a systemd <container>.service unit per container
+Options:
+	-config="./config.json"    hipops JSON configuration
+	-out=""                    Directory to write the files to (default stdout)
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+const exportConfig = `{
+  "id": "demo", "env": "dev", "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [{
+    "name": "backend-api", "type": "nodejs", "image": "aminjam/nodejs:latest",
+    "customizations": [{"src": "app.env", "dest": "config/app.env", "template": true}]
+  }],
+  "playbooks": [{
+    "inventory": "tag_App-Role_DEMO",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{"params": "-v {{.App.Dest}}:/home/app -d {{.App.Image}}"}]
+  }]
+}`
+
+func TestExportCommandRun_RenderedFiles(t *testing.T) {
+	spec := utilities.Spec(t)
+	var _ cli.Command = &ExportCommand{}
+	dir, _ := ioutil.TempDir("", "hipops-export")
+	defer os.RemoveAll(dir)
+	config, out := filepath.Join(dir, "config.json"), filepath.Join(dir, "out")
+	ioutil.WriteFile(config, []byte(exportConfig), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("APP={{.App.Name}}\n"), 0600)
+
+	ui := new(cli.MockUi)
+	code := (&ExportCommand{Ui: ui}).Run([]string{"compose", "-config", config, "-out", out})
+	spec.Expect(code).ToEqual(0)
+	compose, err := ioutil.ReadFile(filepath.Join(out, "docker-compose.yml"))
+	spec.Expect(err).ToEqual(nil)
+	m := regexp.MustCompile(`"(\./files/[^:"]+):/home/app/config/app.env:ro"`).FindSubmatch(compose)
+	spec.Expect(len(m)).ToEqual(2)
+	rendered, err := ioutil.ReadFile(filepath.Join(out, string(m[1])))
+	spec.Expect(err, string(rendered)).ToEqual(nil, "APP=demo-nodejs-backend-api\n")
+}
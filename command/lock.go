@@ -0,0 +1,107 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+// resolveRef asks the remote for the commit of the repository's branch or
+// tag. An annotated tag resolves to the commit it points to.
+func resolveRef(r *plugins.Repository) (string, error) {
+	var env []string
+	if r.IsSsh() && r.SshKey != "" {
+		env = []string{fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no", utilities.ExpandPath(r.SshKey))}
+	}
+	var out bytes.Buffer
+	if err := utilities.RunCmdOutput(&out, env, "git", "ls-remote", r.CloneUrl(), r.Ref, r.Ref+"^{}"); err != nil {
+		return "", fmt.Errorf("%s: %s", r.CloneUrl(), err)
+	}
+	refs := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	for _, name := range []string{"refs/tags/" + r.Ref + "^{}", "refs/tags/" + r.Ref, "refs/heads/" + r.Ref, r.Ref} {
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("%s: ref %s is not found", r.CloneUrl(), r.Ref)
+}
+
+type LockCommand struct {
+	Ui     cli.Ui
+	params params
+}
+
+func (c *LockCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("lock", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	c.params.ignoreLock = true
+	scenario, _, err := c.params.loadScenario(&plugins.Passthrough)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer scenario.Workspace.Remove()
+	lock := parser.NewLock()
+	images, repositories := scenario.Lockable()
+	for _, image := range images {
+		registry := scenario.RegistryOf(image)
+		if registry != nil {
+			if err = registry.Resolve(); err != nil {
+				c.Ui.Warn(fmt.Sprintf("%s: %s, resolving it anonymously", image, err))
+				registry = nil
+			}
+		}
+		if lock.Images[image], err = utilities.ImageDigest(image, registry.Login()); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.Ui.Output(fmt.Sprintf("%s -> %s", image, lock.Images[image]))
+	}
+	for _, r := range repositories {
+		key := parser.RepositoryKey(r)
+		if lock.Repositories[key], err = resolveRef(r); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.Ui.Output(fmt.Sprintf("%s -> %s", key, lock.Repositories[key]))
+	}
+	fileName := filepath.Join(filepath.Dir(c.params.config), parser.LOCK_FILE)
+	if err = lock.Write(fileName); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	c.Ui.Info(fmt.Sprintf("Wrote %s", fileName))
+	return 0
+}
+
+func (c *LockCommand) Synopsis() string {
+	return "Pins the images and repositories of a JSON scenerio"
+}
+func (c *LockCommand) Help() string {
+	helpText := `
+Usage: hipops lock [options]
+Resolves the image tag of every app to a digest through its registry and
+every repository branch or tag to a commit, and writes them to hipops.lock
+next to the scenario
+Options:
+	-config="./config.json"    hipops JSON configuration
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+const lockConfig = `{
+  "id": "demo", "env": "dev", "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [{"name": "mongo", "type": "db", "image": "%s/aminjam/mongodb:latest"}],
+  "playbooks": [{
+    "inventory": "db",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{"params": "-d {{.App.Image}}"}]
+  }]
+}`
+
+func TestLockCommandRun(t *testing.T) {
+	spec := utilities.Spec(t)
+	var _ cli.Command = &LockCommand{}
+	const digest = "sha256:4f2b6a7c1d9e0a3b5c7d9e1f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a0b"
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "hipops-lock")
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(lockConfig, host)), 0600)
+
+	ui := new(cli.MockUi)
+	spec.Expect((&LockCommand{Ui: ui}).Run([]string{"-config", config})).ToEqual(0)
+	lock, err := parser.ReadLock(filepath.Join(dir, parser.LOCK_FILE))
+	pinned := host + "/aminjam/mongodb@" + digest
+	spec.Expect(err, lock.Images[host+"/aminjam/mongodb:latest"]).ToEqual(nil, pinned)
+
+	ui = new(cli.MockUi)
+	(&PlanCommand{Ui: ui}).Run([]string{"-config", config})
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("-d " + pinned)
+
+	// a stale lock is only refused with -locked
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(lockConfig, host+"/mirror")), 0600)
+	p := &params{config: config}
+	_, _, err = p.loadScenario(&plugins.Passthrough)
+	spec.Expect(err).ToEqual(nil)
+	p.locked = true
+	_, _, err = p.loadScenario(&plugins.Passthrough)
+	spec.ExpectString(err.Error()).ToContain("hipops.lock does not pin " + host + "/mirror/aminjam/mongodb:latest")
+
+	// so is a lock pinning an app the scenario no longer has
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(lockConfig, host)), 0600)
+	lock.Images["aminjam/removed:latest"] = "aminjam/removed@" + digest
+	lock.Write(filepath.Join(dir, parser.LOCK_FILE))
+	_, _, err = p.loadScenario(&plugins.Passthrough)
+	spec.ExpectString(err.Error()).ToContain("hipops.lock pins aminjam/removed:latest, which the scenario does not deploy")
+
+	// registry credentials are only read when logging in
+	private := strings.Replace(lockConfig, `mongodb:latest"`, `mongodb:latest", "registry": {"server": "%[1]s", "username": "deploy", "passwordEnv": "HIPOPS_TEST_UNSET"}`, 1)
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(private, host)), 0600)
+	ui = new(cli.MockUi)
+	spec.Expect((&LockCommand{Ui: ui}).Run([]string{"-config", config})).ToEqual(0)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("$HIPOPS_TEST_UNSET is not set, resolving it anonymously")
+	inventory := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(inventory, []byte("[db]\n10.0.0.5\n"), 0600)
+	ui = new(cli.MockUi)
+	spec.Expect((&PlanCommand{Ui: ui}).Run([]string{"-config", config, "-inventory", inventory})).ToEqual(0)
+}
+
+func TestResolveRef(t *testing.T) {
+	spec := utilities.Spec(t)
+	origin, _ := ioutil.TempDir("", "hipops-origin")
+	defer os.RemoveAll(origin)
+	ioutil.WriteFile(filepath.Join(origin, "README"), []byte("backend"), 0600)
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "README"},
+		{"-c", "user.name=hipops", "-c", "user.email=hipops@example.com", "commit", "-q", "-m", "init"},
+		{"-c", "user.name=hipops", "-c", "user.email=hipops@example.com", "tag", "-a", "v1", "-m", "v1"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = origin
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(string(out))
+		}
+	}
+	head, _ := exec.Command("git", "-C", origin, "rev-parse", "HEAD").Output()
+
+	for _, ref := range []string{"main", "v1"} {
+		commit, err := resolveRef(&plugins.Repository{Url: origin, Ref: ref})
+		spec.Expect(err, commit).ToEqual(nil, strings.TrimSpace(string(head)))
+	}
+	_, err := resolveRef(&plugins.Repository{Url: origin, Ref: "missing"})
+	spec.ExpectString(err.Error()).ToContain("ref missing is not found")
+}
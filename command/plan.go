@@ -0,0 +1,87 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/mitchellh/cli"
+)
+
+type PlanCommand struct {
+	Ui     cli.Ui
+	params params
+}
+
+func (c *PlanCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	cmdFlags.StringVar(&c.params.inventory, "inventory", "./hosts/local", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	scenario, actions, err := c.params.loadScenario(&plugins.Passthrough)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer scenario.Workspace.Remove()
+	hosts, errs, warnings := resolveHosts(actions, c.params.inventory)
+	for _, a := range actions {
+		c.Ui.Output(fmt.Sprintf("%s (%s) -> %s", a.Name, a.State(), a.Inventory))
+		names := []string{}
+		for _, h := range hosts[a] {
+			names = append(names, fmt.Sprintf("%s (%s)", h.Name, h.Addr()))
+		}
+		if len(names) != 0 {
+			c.Ui.Output(fmt.Sprintf("  hosts: %s", strings.Join(names, ", ")))
+		}
+		if r := a.Registry; r != nil {
+			c.Ui.Output(fmt.Sprintf("  registry %s as %s", r.Server, r.Username))
+		}
+		if b := a.Build; b != nil {
+			c.Ui.Output(fmt.Sprintf("  build %s from %s", b.Tag, b.Context))
+		}
+		if r := a.Repository; r != nil {
+			c.Ui.Output(fmt.Sprintf("  repository %s at %s -> %s", r.CloneUrl(), r.Ref, r.Path(a.Dest)))
+		}
+		for _, f := range a.Files {
+			line := fmt.Sprintf("  file %s -> %s (%04o", f.Src, f.Dest, f.FileMode())
+			if chown := f.Chown(); chown != "" {
+				line += " " + chown
+			}
+			c.Ui.Output(line + ")")
+		}
+		for _, container := range a.Containers {
+			c.Ui.Output(fmt.Sprintf("  container %s (%s): %s", container.Name, container.State, container.Params))
+		}
+	}
+	for _, w := range warnings {
+		c.Ui.Warn(w)
+	}
+	for _, e := range errs {
+		c.Ui.Error(e)
+	}
+	if len(errs) != 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *PlanCommand) Synopsis() string {
+	return "Shows what a JSON scenerio would run and where"
+}
+func (c *PlanCommand) Help() string {
+	helpText := `
+Usage: hipops plan [options]
+Shows every action of a JSON scenerio with the hosts its inventory group
+resolves to
+Options:
+	-config="./config.json"       hipops JSON configuration
+	-inventory="./hosts/local"    INI, YAML, JSON or executable inventory
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aminjam/hipops/inventory"
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+// loadScenario reads the scenario at p.config, parses it with the plugin
+// and applies the params to every action. hipops.lock next to the scenario
+// pins its images and repositories unless ignoreLock is set. The
+// scenario's run workspace is left for the caller to remove.
+func (p *params) loadScenario(plugin *plugins.Plugin) (*parser.Scenario, []*plugins.Action, error) {
+	config, err := ioutil.ReadFile(p.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var scenario parser.Scenario
+	if err = scenario.Configure(config); err != nil {
+		return nil, nil, err
+	}
+	if scenario.Workspace, err = utilities.NewWorkspace(p.workdir, p.keepWorkdir); err != nil {
+		return nil, nil, err
+	}
+	scenario.Workspace.Cache = &utilities.Cache{Dir: utilities.CacheDir("downloads"), Offline: p.offline}
+	scenario.BaseDir = filepath.Dir(p.config)
+	scenario.Locked = p.locked
+	// commands without -inventory resolve `addr` from the default one
+	if scenario.InventoryFile = p.inventory; p.inventory == "" {
+		scenario.InventoryFile = "./hosts/local"
+	}
+	if lock, err := parser.ReadLock(filepath.Join(scenario.BaseDir, parser.LOCK_FILE)); err == nil && !p.ignoreLock {
+		scenario.Lock = lock
+	} else if err != nil && !os.IsNotExist(err) {
+		scenario.Workspace.Remove()
+		return nil, nil, err
+	}
+	actions, err := scenario.Parse(plugin)
+	if err != nil {
+		scenario.Workspace.Remove()
+		return nil, nil, err
+	}
+	for _, a := range actions {
+		if err = p.toAction(a); err != nil {
+			scenario.Workspace.Remove()
+			return nil, nil, err
+		}
+	}
+	return &scenario, actions, nil
+}
+
+// resolveHosts resolves the inventory group of every action, from the
+// scenario's hosts or from the inventory file. Missing groups are errors
+// and groups without hosts are warnings.
+func resolveHosts(actions []*plugins.Action, inventoryFile string) (hosts map[*plugins.Action][]*inventory.Host, errs, warnings []string) {
+	hosts = map[*plugins.Action][]*inventory.Host{}
+	var file *inventory.Inventory
+	var fileErr error
+	for _, a := range actions {
+		inv := a.Hosts
+		if inv == nil {
+			if file == nil && fileErr == nil {
+				file, fileErr = inventory.Load(inventoryFile)
+				if fileErr != nil {
+					errs = append(errs, fmt.Sprintf("inventory %s: %s", inventoryFile, fileErr))
+				}
+			}
+			if fileErr != nil {
+				continue
+			}
+			inv = file
+		}
+		resolved, err := inv.Hosts(a.Inventory)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s (known groups: %v)", a.Name, err, inv.Groups()))
+			continue
+		}
+		if len(resolved) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: inventory group %s has no hosts", a.Name, a.Inventory))
+		}
+		hosts[a] = resolved
+	}
+	return
+}
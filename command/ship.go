@@ -0,0 +1,56 @@
+package command
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/plugins/shell"
+	"github.com/aminjam/hipops/utilities"
+)
+
+// ship prepares a repository in "ship" mode: it is cloned or fetched where
+// hipops runs, built, and packed without .git into the run workspace, so the
+// plugins unpack Archive on the hosts instead of cloning there.
+func ship(a *plugins.Action, ws *utilities.Workspace) error {
+	r := a.Repository
+	if r == nil || !r.Shipped() || r.Archive != "" {
+		return nil
+	}
+	reposDir := utilities.CacheDir("repositories")
+	if err := os.MkdirAll(reposDir, 0700); err != nil {
+		return err
+	}
+	checkout := filepath.Join(reposDir, fmt.Sprintf("%x", sha256.Sum256([]byte(r.CloneUrl())))[:16])
+	keyPath := ""
+	if r.IsSsh() && r.SshKey != "" {
+		keyPath = utilities.ExpandPath(r.SshKey)
+	}
+	local := *r
+	local.Folder = ""
+	if err := utilities.RunCmd("bash", "-c", shell.Repository(&local, checkout, keyPath)); err != nil {
+		return fmt.Errorf("%s: %s", a.Name, err)
+	}
+	// the checkout is reused across runs, so earlier builds are removed
+	clean := fmt.Sprintf("cd %s && git clean -ffdxq && git submodule foreach --quiet --recursive git clean -ffdxq", shell.Quote(checkout))
+	if err := utilities.RunCmd("bash", "-c", clean); err != nil {
+		return fmt.Errorf("%s: clean: %s", a.Name, err)
+	}
+	if r.Build != "" {
+		if err := utilities.RunCmd("bash", "-c", fmt.Sprintf("cd %s && %s", shell.Quote(checkout), r.Build)); err != nil {
+			return fmt.Errorf("%s: build: %s", a.Name, err)
+		}
+	}
+	archive, err := ws.Create("repository-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	if err = utilities.Tarball(checkout, archive, ".git"); err != nil {
+		return err
+	}
+	r.Archive = archive.Name()
+	return nil
+}
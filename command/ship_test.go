@@ -0,0 +1,68 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+func TestShip(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-ship")
+	defer os.RemoveAll(dir)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	defer os.Unsetenv("XDG_CACHE_HOME")
+
+	origin := filepath.Join(dir, "origin")
+	os.MkdirAll(origin, 0700)
+	ioutil.WriteFile(filepath.Join(origin, "README"), []byte("backend"), 0600)
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "README"},
+		{"-c", "user.name=hipops", "-c", "user.email=hipops@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = origin
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(string(out))
+		}
+	}
+
+	ws, _ := utilities.NewWorkspace(dir, false)
+	defer ws.Remove()
+	// the url is a local path here, which Configure would not accept
+	r := &plugins.Repository{Url: origin, Ref: "main", Mode: plugins.SHIP_REPOSITORY_MODE, Build: "echo built > dist.txt", Folder: "src"}
+	a := &plugins.Action{Name: "backend-api", Dest: filepath.Join(dir, "data"), Repository: r}
+	spec.Expect(ship(a, ws)).ToEqual(nil)
+	spec.Expect(filepath.Dir(r.Archive)).ToEqual(ws.Dir)
+
+	archive, _ := os.Open(r.Archive)
+	defer archive.Close()
+	spec.Expect(utilities.Untar(archive, r.Path(a.Dest))).ToEqual(nil)
+	readme, _ := ioutil.ReadFile(filepath.Join(dir, "data/src/README"))
+	built, _ := ioutil.ReadFile(filepath.Join(dir, "data/src/dist.txt"))
+	spec.Expect(string(readme), string(built)).ToEqual("backend", "built\n")
+	_, err := os.Stat(filepath.Join(dir, "data/src/.git"))
+	spec.Expect(os.IsNotExist(err)).ToEqual(true)
+
+	// the next ship starts from a clean checkout
+	r.Archive, r.Build = "", "echo rebuilt > other.txt"
+	spec.Expect(ship(a, ws)).ToEqual(nil)
+	archive, _ = os.Open(r.Archive)
+	defer archive.Close()
+	rebuilt := filepath.Join(dir, "rebuilt")
+	spec.Expect(utilities.Untar(archive, rebuilt)).ToEqual(nil)
+	_, err = os.Stat(filepath.Join(rebuilt, "dist.txt"))
+	spec.Expect(os.IsNotExist(err)).ToEqual(true)
+	_, err = os.Stat(filepath.Join(rebuilt, "other.txt"))
+	spec.Expect(err).ToEqual(nil)
+
+	// a cloned repository is left to the plugins
+	cloned := &plugins.Action{Repository: &plugins.Repository{Url: origin, Ref: "main"}}
+	spec.Expect(ship(cloned, ws), cloned.Repository.Archive).ToEqual(nil, "")
+}
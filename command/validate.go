@@ -0,0 +1,59 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/mitchellh/cli"
+)
+
+type ValidateCommand struct {
+	Ui     cli.Ui
+	params params
+}
+
+func (c *ValidateCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	cmdFlags.StringVar(&c.params.inventory, "inventory", "./hosts/local", "")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	scenario, actions, err := c.params.loadScenario(&plugins.Passthrough)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer scenario.Workspace.Remove()
+	_, errs, warnings := resolveHosts(actions, c.params.inventory)
+	for _, w := range warnings {
+		c.Ui.Warn(w)
+	}
+	for _, e := range errs {
+		c.Ui.Error(e)
+	}
+	if len(errs) != 0 {
+		return 1
+	}
+	c.Ui.Info(fmt.Sprintf("Scenario %s is valid.", scenario.Id))
+	return 0
+}
+
+func (c *ValidateCommand) Synopsis() string {
+	return "Validates a JSON scenerio against the inventory"
+}
+func (c *ValidateCommand) Help() string {
+	helpText := `
+Usage: hipops validate [options]
+Validates a JSON scenerio and checks that the inventory group of every
+playbook exists
+Options:
+	-config="./config.json"       hipops JSON configuration
+	-inventory="./hosts/local"    INI, YAML, JSON or executable inventory
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+const validateConfig = `{
+  "id": "demo", "env": "dev", "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [{"name": "mongo", "type": "db", "image": "aminjam/mongodb:latest"}],
+  "playbooks": [{
+    "inventory": "%s",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{"params": "-d {{.App.Image}}"}]
+  }]
+}`
+
+func writeScenario(t *testing.T, group string) (config, hosts string) {
+	dir, _ := ioutil.TempDir("", "hipops-command")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	config = filepath.Join(dir, "config.json")
+	hosts = filepath.Join(dir, "hosts")
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(validateConfig, group)), 0600)
+	ioutil.WriteFile(hosts, []byte("[tag_App-Role_DEMO]\n10.0.0.2\n\n[empty]\n"), 0600)
+	return
+}
+
+func TestValidateCommand_implements(t *testing.T) {
+	var _ cli.Command = &ValidateCommand{}
+	var _ cli.Command = &PlanCommand{}
+}
+
+func TestValidateCommandRun(t *testing.T) {
+	spec := utilities.Spec(t)
+
+	config, hosts := writeScenario(t, "tag_App-Role_DEMO")
+	ui := new(cli.MockUi)
+	code := (&ValidateCommand{Ui: ui}).Run([]string{"-config", config, "-inventory", hosts})
+	spec.Expect(code).ToEqual(0)
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("Scenario demo is valid.")
+
+	ui = new(cli.MockUi)
+	code = (&PlanCommand{Ui: ui}).Run([]string{"-config", config, "-inventory", hosts})
+	spec.Expect(code).ToEqual(0)
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("demo-db-mongo (running) -> tag_App-Role_DEMO\n  hosts: 10.0.0.2 (10.0.0.2:22)")
+
+	config, hosts = writeScenario(t, "tag_App-Role_DEMO-typo")
+	ui = new(cli.MockUi)
+	code = (&ValidateCommand{Ui: ui}).Run([]string{"-config", config, "-inventory", hosts})
+	spec.Expect(code).ToEqual(1)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("inventory group tag_App-Role_DEMO-typo is not found (known groups: [empty tag_App-Role_DEMO])")
+
+	config, hosts = writeScenario(t, "empty")
+	ui = new(cli.MockUi)
+	code = (&ValidateCommand{Ui: ui}).Run([]string{"-config", config, "-inventory", hosts})
+	spec.Expect(code).ToEqual(0)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("inventory group empty has no hosts")
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/mitchellh/cli"
+)
+
+type VolumesCommand struct {
+	Ui     cli.Ui
+	params params
+}
+
+func (c *VolumesCommand) Run(args []string) int {
+	if len(args) == 0 || args[0] != "restore" {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	var appName, volumeName, snapshot string
+	cmdFlags := flag.NewFlagSet("volumes restore", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&c.params.config, "config", "./config.json", "")
+	cmdFlags.StringVar(&c.params.plugin, "plugin", "", "")
+	cmdFlags.StringVar(&c.params.privateKey, "private-key", "", "")
+	cmdFlags.StringVar(&appName, "app", "", "")
+	cmdFlags.StringVar(&volumeName, "volume", "", "")
+	cmdFlags.StringVar(&snapshot, "snapshot", "", "")
+	c.params.pluginFlags(cmdFlags)
+	if err := cmdFlags.Parse(args[1:]); err != nil {
+		return 1
+	}
+	if c.params.plugin == "" || appName == "" || volumeName == "" {
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	plugin, err := c.params.validatePlugin(cmdFlags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	restorer, ok := (*plugin).(plugins.VolumeRestorer)
+	if !ok {
+		c.Ui.Error(fmt.Sprintf("plugin %s cannot restore volumes", c.params.plugin))
+		return 1
+	}
+	scenario, actions, err := c.params.loadScenario(plugin)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer scenario.Workspace.Remove()
+	name, err := scenario.AppName(appName)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// an app deployed by several playbooks is restored once per group
+	restored := map[string]bool{}
+	for _, a := range actions {
+		if a.Name != name || restored[a.Inventory] {
+			continue
+		}
+		v := findVolume(a, volumeName)
+		if v == nil {
+			c.Ui.Error(fmt.Sprintf("%s has no volume %s", a.Name, volumeName))
+			return 1
+		}
+		c.Ui.Output(fmt.Sprintf("Restoring %s of %s on %s", v.Name, a.Name, a.Inventory))
+		if err = restorer.RestoreVolume(a, v, snapshot); err != nil {
+			c.Ui.Error(fmt.Sprintf("%s: %s", a.Name, err))
+			return 1
+		}
+		restored[a.Inventory] = true
+	}
+	if len(restored) == 0 {
+		c.Ui.Error(fmt.Sprintf("app %s is not deployed by any playbook", appName))
+		return 1
+	}
+	return 0
+}
+
+func findVolume(a *plugins.Action, name string) *plugins.Volume {
+	for _, v := range a.Volumes {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (c *VolumesCommand) Synopsis() string {
+	return "Restores app volumes from their snapshots"
+}
+func (c *VolumesCommand) Help() string {
+	helpText := `
+Usage: hipops volumes restore [options]
+Stops the app's containers on every host, replaces the volume's content
+with a snapshot taken before a deploy and starts them again
+Options:
+	-config="./config.json"    hipops JSON configuration
+	-plugin=""                 Name of the plugin (ansible, docker or ssh)
+	-private-key=""            SSH Host Private Key
+	-app=""                    Name the app is declared or configured with
+	-volume=""                 Name of the app's volume
+	-snapshot=""               File name of the snapshot (default the latest)
+
+	The options of the ansible, docker and ssh plugins are the ones of exec.
+`
+	return strings.TrimSpace(helpText)
+}
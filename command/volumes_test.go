@@ -0,0 +1,77 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/utilities"
+	"github.com/mitchellh/cli"
+)
+
+func TestVolumesCommandRun(t *testing.T) {
+	spec := utilities.Spec(t)
+	var _ cli.Command = &VolumesCommand{}
+	config, _ := writeScenario(t, "tag_App-Role_DEMO")
+	dir, _ := ioutil.TempDir("", "hipops-volumes")
+	defer os.RemoveAll(dir)
+
+	ui := new(cli.MockUi)
+	code := (&VolumesCommand{Ui: ui}).Run([]string{"restore", "-config", config, "-plugin", "script", "-script-dir", dir, "-app", "mongo", "-volume", "data"})
+	spec.Expect(code).ToEqual(1)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("plugin script cannot restore volumes")
+
+	ui = new(cli.MockUi)
+	code = (&VolumesCommand{Ui: ui}).Run([]string{"restore", "-config", config, "-plugin", "docker", "-docker-host", "unix://" + filepath.Join(dir, "docker.sock"), "-app", "mongo", "-volume", "data"})
+	spec.Expect(code).ToEqual(1)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("demo-db-mongo has no volume data")
+}
+
+const collidingConfig = `{
+  "id": "demo", "env": "dev", "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [
+    {"name": "analytics-mongo", "type": "db", "image": "aminjam/mongodb:latest", "volumes": [{"name": "data", "target": "/data/db"}]},
+    {"name": "mongo", "type": "db", "image": "aminjam/mongodb:latest", "volumes": [{"name": "data", "target": "/data/db"}]}%s
+  ],
+  "playbooks": [{
+    "inventory": "tag_App-Role_DEMO",
+    "apps": ["{{index .Apps 0}}", "{{index .Apps 1}}"],
+    "containers": [{"params": "-d {{.App.Image}}"}]
+  }]
+}`
+
+func TestVolumesCommandRun_AppName(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-volumes")
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.json")
+	socket := "unix://" + filepath.Join(dir, "docker.sock")
+
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(collidingConfig, "")), 0600)
+	ui := new(cli.MockUi)
+	code := (&VolumesCommand{Ui: ui}).Run([]string{"restore", "-config", config, "-plugin", "docker", "-docker-host", socket, "-app", "mongo", "-volume", "data"})
+	spec.Expect(code).ToEqual(1)
+	spec.ExpectString(ui.OutputWriter.String()).ToContain("Restoring data of demo-db-mongo on tag_App-Role_DEMO")
+	spec.Expect(strings.Contains(ui.OutputWriter.String()+ui.ErrorWriter.String(), "analytics")).ToEqual(false)
+
+	// apps naming their volumes alike still get a docker volume each
+	p := &params{config: config, plugin: "script", scriptDir: dir}
+	plugin, err := p.validatePlugin(nil)
+	spec.Expect(err).ToEqual(nil)
+	scenario, actions, err := p.loadScenario(plugin)
+	spec.Expect(err).ToEqual(nil)
+	defer scenario.Workspace.Remove()
+	spec.Expect(actions[0].Volumes[0].Source(), actions[1].Volumes[0].Source()).ToEqual("demo-db-analytics-mongo_data", "demo-db-mongo_data")
+	spec.ExpectString(actions[1].Containers[0].Params).ToContain("-v demo-db-mongo_data:/data/db")
+
+	ioutil.WriteFile(config, []byte(fmt.Sprintf(collidingConfig, `,
+    {"name": "demo-db-mongo", "image": "mongo"}`)), 0600)
+	ui = new(cli.MockUi)
+	code = (&VolumesCommand{Ui: ui}).Run([]string{"restore", "-config", config, "-plugin", "docker", "-docker-host", socket, "-app", "demo-db-mongo", "-volume", "data"})
+	spec.Expect(code).ToEqual(1)
+	spec.ExpectString(ui.ErrorWriter.String()).ToContain("app demo-db-mongo matches several apps: demo-db-mongo, demo-db-mongo")
+}
@@ -16,6 +16,18 @@ func init() {
 
 	Commands = map[string]cli.CommandFactory{
 
+		"ansible": func() (cli.Command, error) {
+			return &command.AnsibleCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"build": func() (cli.Command, error) {
+			return &command.BuildCommand{
+				Ui: ui,
+			}, nil
+		},
+
 		"exec": func() (cli.Command, error) {
 			return &command.ExecCommand{
 				ShutdownCh: makeShutdownCh(),
@@ -23,6 +35,36 @@ func init() {
 			}, nil
 		},
 
+		"export": func() (cli.Command, error) {
+			return &command.ExportCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"lock": func() (cli.Command, error) {
+			return &command.LockCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"plan": func() (cli.Command, error) {
+			return &command.PlanCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"validate": func() (cli.Command, error) {
+			return &command.ValidateCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"volumes": func() (cli.Command, error) {
+			return &command.VolumesCommand{
+				Ui: ui,
+			}, nil
+		},
+
 		/*
 			"api": func() (cli.Command, error) {
 				return &command.ApiCommand{
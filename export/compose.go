@@ -0,0 +1,170 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+type compose struct{}
+
+func (e *compose) Export(sc *parser.Scenario, actions []*plugins.Action) ([]*File, []string, error) {
+	buf := new(bytes.Buffer)
+	warnings := []string{}
+	fmt.Fprintf(buf, "# Generated by hipops from scenario %s (%s).\nversion: \"2\"\nservices:\n", sc.Id, sc.Env)
+	networks, drivers := []string{}, map[string]string{}
+	support := []*File{}
+	for _, a := range actions {
+		for _, n := range a.Networks {
+			if _, ok := drivers[n.Name]; !ok {
+				networks = append(networks, n.Name)
+			}
+			drivers[n.Name] = n.Driver
+		}
+		for _, c := range a.Containers {
+			if c.State == utilities.ABSENT_APP_STATE {
+				warnings = append(warnings, fmt.Sprintf("%s: container is absent and is not exported", c.Name))
+				continue
+			}
+			if hasHostFacts(c) {
+				warnings = append(warnings, fmt.Sprintf("%s: host facts in params are kept as written", c.Name))
+			}
+			p, err := plugins.ParseParams(c.Params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", c.Name, err)
+			}
+			fmt.Fprintf(buf, "  %s:\n", quote(c.Name))
+			fmt.Fprintf(buf, "    image: %s\n", quote(p.Image))
+			fmt.Fprintf(buf, "    container_name: %s\n", quote(c.Name))
+			if p.Hostname != "" {
+				fmt.Fprintf(buf, "    hostname: %s\n", quote(p.Hostname))
+			}
+			if p.Restart != "" {
+				fmt.Fprintf(buf, "    restart: %s\n", quote(p.Restart))
+			}
+			if p.Workdir != "" {
+				fmt.Fprintf(buf, "    working_dir: %s\n", quote(p.Workdir))
+			}
+			if len(p.Cmd) != 0 {
+				fmt.Fprintf(buf, "    command:\n")
+				writeList(buf, p.Cmd)
+			}
+			for i := 0; i < len(p.Extra); i++ {
+				switch p.Extra[i] {
+				case "-i", "--interactive":
+					fmt.Fprintf(buf, "    stdin_open: true\n")
+				case "-t", "--tty":
+					fmt.Fprintf(buf, "    tty: true\n")
+				case "-it", "-ti":
+					fmt.Fprintf(buf, "    stdin_open: true\n    tty: true\n")
+				case "--privileged":
+					fmt.Fprintf(buf, "    privileged: true\n")
+				default:
+					flag := p.Extra[i]
+					if i+1 < len(p.Extra) && !strings.HasPrefix(p.Extra[i+1], "-") {
+						i++
+						flag += " " + p.Extra[i]
+					}
+					warnings = append(warnings, fmt.Sprintf("%s: %s cannot be represented in docker-compose", c.Name, flag))
+				}
+			}
+			if c.State == utilities.STOPPED_APP_STATE {
+				warnings = append(warnings, fmt.Sprintf("%s: stopped state cannot be represented in docker-compose", c.Name))
+			}
+			if len(p.Env) != 0 {
+				fmt.Fprintf(buf, "    environment:\n")
+				writeList(buf, p.Env)
+			}
+			if len(p.Ports) != 0 {
+				fmt.Fprintf(buf, "    ports:\n")
+				writeList(buf, p.Ports)
+			}
+			if len(p.Links) != 0 {
+				fmt.Fprintf(buf, "    links:\n")
+				writeList(buf, p.Links)
+			}
+			joined := c.Connect
+			if p.Network != "" {
+				joined = append([]*plugins.Network{{Name: p.Network, Aliases: p.NetworkAliases}}, joined...)
+				if _, ok := drivers[p.Network]; !ok {
+					networks, drivers[p.Network] = append(networks, p.Network), ""
+				}
+			}
+			if len(joined) != 0 {
+				fmt.Fprintf(buf, "    networks:\n")
+				for _, n := range joined {
+					if len(n.Aliases) == 0 {
+						fmt.Fprintf(buf, "      %s: {}\n", quote(n.Name))
+						continue
+					}
+					fmt.Fprintf(buf, "      %s:\n        aliases:\n", quote(n.Name))
+					for _, alias := range n.Aliases {
+						fmt.Fprintf(buf, "          - %s\n", quote(alias))
+					}
+				}
+			}
+			volumes := make([]mount, len(p.Volumes))
+			for i, v := range p.Volumes {
+				volumes[i] = parseVolume(v)
+			}
+			files, missing := customizationMounts(a, volumes)
+			warnings = append(warnings, missing...)
+			if len(p.Volumes)+len(files) != 0 {
+				fmt.Fprintf(buf, "    volumes:\n")
+				writeList(buf, p.Volumes)
+				for _, f := range files {
+					source, file, err := keepSource(sc, f.Source)
+					if err != nil {
+						return nil, nil, err
+					}
+					if file != nil {
+						support = append(support, file)
+					}
+					writeList(buf, []string{fmt.Sprintf("%s:%s:ro", source, f.Target)})
+				}
+			}
+		}
+	}
+	if len(networks) != 0 {
+		fmt.Fprintf(buf, "networks:\n")
+		for _, name := range networks {
+			if drivers[name] == "" {
+				fmt.Fprintf(buf, "  %s: {}\n", quote(name))
+				continue
+			}
+			fmt.Fprintf(buf, "  %s:\n    driver: %s\n", quote(name), quote(drivers[name]))
+		}
+	}
+	return append([]*File{{Name: "docker-compose.yml", Content: buf.Bytes()}}, support...), warnings, nil
+}
+
+// keepSource copies a source in the run workspace, such as a rendered
+// customization, into files/ next to docker-compose.yml, since the
+// workspace is gone once the export is written.
+func keepSource(sc *parser.Scenario, source string) (string, *File, error) {
+	if sc.Workspace == nil {
+		return source, nil, nil
+	}
+	rel, err := filepath.Rel(sc.Workspace.Dir, source)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return source, nil, nil
+	}
+	content, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", nil, err
+	}
+	name := filepath.ToSlash(filepath.Join("files", rel))
+	return "./" + name, &File{Name: name, Content: content, Support: true}, nil
+}
+
+func writeList(buf *bytes.Buffer, items []string) {
+	for _, item := range items {
+		fmt.Fprintf(buf, "      - %s\n", quote(item))
+	}
+}
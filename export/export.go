@@ -0,0 +1,104 @@
+// Package export converts the actions of a parsed scenario into the
+// configuration formats of other tools.
+package export
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+)
+
+// File is one file an exporter produces.
+type File struct {
+	Name    string
+	Content []byte
+	// Support marks a file the others refer to by its path relative to
+	// them, such as a rendered customization
+	Support bool
+}
+
+// Exporter converts the actions of a scenario. Warnings report the parts
+// of the scenario the format cannot represent.
+type Exporter interface {
+	Export(sc *parser.Scenario, actions []*plugins.Action) (files []*File, warnings []string, err error)
+}
+
+var Exporters = map[string]Exporter{
+	"compose":    &compose{},
+	"fleet":      &systemd{fleet: true},
+	"kubernetes": &kubernetes{},
+	"systemd":    &systemd{},
+}
+
+func Names() []string {
+	names := []string{}
+	for name := range Exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mount is a volume or customization mapped into a container.
+type mount struct {
+	Source, Target string
+	ReadOnly       bool
+	File           *plugins.Customization
+}
+
+func parseVolume(v string) mount {
+	parts := strings.Split(v, ":")
+	m := mount{Source: parts[0], Target: parts[0]}
+	if len(parts) > 1 {
+		m.Target = parts[1]
+	}
+	if len(parts) > 2 && strings.Contains(parts[2], "ro") {
+		m.ReadOnly = true
+	}
+	return m
+}
+
+// customizationMounts maps the customizations of an action into the
+// container through the volume that holds their dest on the host.
+func customizationMounts(a *plugins.Action, volumes []mount) ([]mount, []string) {
+	var mounts []mount
+	var warnings []string
+	for _, f := range a.Files {
+		found := false
+		for _, v := range volumes {
+			if rel := strings.TrimPrefix(f.Dest, v.Source+"/"); rel != f.Dest {
+				mounts = append(mounts, mount{Source: f.Src, Target: path.Join(v.Target, rel), ReadOnly: true, File: f})
+				found = true
+				break
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("%s: customization %s is not under any volume of the container", a.Name, f.Dest))
+		}
+	}
+	return mounts, warnings
+}
+
+func link(l string) (name, alias string) {
+	parts := strings.SplitN(l, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], parts[0]
+	}
+	return parts[0], parts[1]
+}
+
+// hasHostFacts tells whether the params reference facts of the host, as
+// `{{ host "ip" }}` or the ansible `{{ box_x }}` form, which no format resolves.
+func hasHostFacts(c *plugins.Container) bool {
+	return strings.Contains(c.Params, "{{") || len(plugins.FactsOf([]*plugins.Container{c})) != 0
+}
+
+// quote writes a YAML double-quoted scalar.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+const config = `{
+  "id": "demo",
+  "env": "dev",
+  "dest": "/data",
+  "oses": [{"user": "core"}],
+  "apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017]
+  }, {
+    "name": "backend-api",
+    "type": "nodejs",
+    "image": "aminjam/nodejs:latest",
+    "ports": [3001],
+    "customizations": [{"src": "%s", "dest": "config/app.env"}]
+  }],
+  "playbooks": [{
+    "inventory": "tag_App-Role_DEMO",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{
+      "params": "-v {{.App.Dest}}:/home/app -p 9990:{{index .App.Ports 0}} -e MONGO_OPTIONS='--smallfiles' -d {{.App.Image}} /run.sh"
+    }]
+  }, {
+    "inventory": "tag_App-Role_DEMO",
+    "apps": ["{{index .Apps 1}}"],
+    "containers": [{
+      "params": "-v {{.App.Dest}}:/home/app -h {{ box_hostname }} --cpu-shares 512 -e NODE_ENV=development --link {{(index .Apps 0).Name}}:mongo -d {{.App.Image}} /run.sh"
+    }]
+  }]
+}`
+
+func parse(t *testing.T) (*parser.Scenario, []*plugins.Action) {
+	dir, _ := ioutil.TempDir("", "hipops-export")
+	src := filepath.Join(dir, "app.env")
+	ioutil.WriteFile(src, []byte("NODE_ENV=development\n"), 0600)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var sc parser.Scenario
+	if err := sc.Configure([]byte(fmt.Sprintf(config, src))); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := sc.Parse(&plugins.Passthrough)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sc, actions
+}
+
+func TestExport_compose(t *testing.T) {
+	spec := utilities.Spec(t)
+	sc, actions := parse(t)
+	files, warnings, err := Exporters["compose"].Export(sc, actions)
+	spec.Expect(err, len(files), files[0].Name).ToEqual(nil, 1, "docker-compose.yml")
+
+	out := utilities.Spec(t).ExpectString(string(files[0].Content))
+	out.ToContain(`  "demo-db-mongo":
+    image: "aminjam/mongodb:latest"
+    container_name: "demo-db-mongo"
+    command:
+      - "/run.sh"
+    environment:
+      - "MONGO_OPTIONS=--smallfiles"
+    ports:
+      - "9990:27017"
+    volumes:
+      - "/data/demo-dev/db/demo-db-mongo:/home/app"
+`)
+	out.ToContain(`    hostname: "{{ box_hostname }}"`)
+	out.ToContain(`    links:
+      - "demo-db-mongo:mongo"`)
+	out.ToContain(`/app.env:/home/app/config/app.env:ro"`)
+
+	all := fmt.Sprint(warnings)
+	utilities.Spec(t).ExpectString(all).ToContain("demo-nodejs-backend-api: --cpu-shares 512 cannot be represented")
+	utilities.Spec(t).ExpectString(all).ToContain("demo-nodejs-backend-api: host facts in params")
+}
+
+func TestExport_kubernetes(t *testing.T) {
+	spec := utilities.Spec(t)
+	sc, actions := parse(t)
+	files, warnings, err := Exporters["kubernetes"].Export(sc, actions)
+	spec.Expect(err, len(files), files[0].Name).ToEqual(nil, 1, "kubernetes.yml")
+
+	out := utilities.Spec(t).ExpectString(string(files[0].Content))
+	out.ToContain(`apiVersion: "apps/v1"
+kind: "Deployment"
+metadata:
+  name: "demo-db-mongo"
+  labels:
+    app: "demo-db-mongo"
+    hipops.io/scenario: "demo"
+    hipops.io/env: "dev"
+spec:
+  replicas: 1
+`)
+	out.ToContain(`        - name: "demo-db-mongo"
+          image: "aminjam/mongodb:latest"
+          args:
+            - "/run.sh"
+          env:
+            - name: "MONGO_OPTIONS"
+              value: "--smallfiles"
+          ports:
+            - containerPort: 27017
+              protocol: "TCP"
+`)
+	out.ToContain(`            - name: "demo-db-mongo-volume-0"
+              mountPath: "/home/app"
+              readOnly: false
+`)
+	out.ToContain(`kind: "ConfigMap"
+metadata:
+  name: "demo-nodejs-backend-api-files"
+`)
+	out.ToContain(`  0-app.env: "NODE_ENV=development\n"`)
+	out.ToContain(`              mountPath: "/home/app/config/app.env"
+              subPath: "0-app.env"
+`)
+	out.ToContain(`kind: "Service"
+metadata:
+  name: "mongo"
+`)
+	out.ToContain(`  selector:
+    app: "demo-db-mongo"
+  ports:
+    - name: "port-27017"
+      port: 27017
+`)
+	utilities.Spec(t).ExpectString(fmt.Sprint(warnings)).ToContain("--cpu-shares cannot be represented in kubernetes")
+}
+
+func TestExport_systemd(t *testing.T) {
+	spec := utilities.Spec(t)
+	sc, actions := parse(t)
+	files, _, err := Exporters["fleet"].Export(sc, actions)
+	spec.Expect(err, len(files)).ToEqual(nil, 2)
+	spec.Expect(files[0].Name, files[1].Name).ToEqual("demo-db-mongo.service", "demo-nodejs-backend-api.service")
+
+	mongo := utilities.Spec(t).ExpectString(string(files[0].Content))
+	mongo.ToContain("ExecStartPre=-/usr/bin/docker kill demo-db-mongo\n")
+	mongo.ToContain("ExecStartPre=/usr/bin/docker pull aminjam/mongodb:latest\n")
+	mongo.ToContain("ExecStart=/usr/bin/docker run --name demo-db-mongo -v /data/demo-dev/db/demo-db-mongo:/home/app -p 9990:27017 -e MONGO_OPTIONS=--smallfiles aminjam/mongodb:latest /run.sh\n")
+	mongo.ToContain("[X-Fleet]\nMachineMetadata=inventory=tag_App-Role_DEMO\n")
+
+	// a value equal to the image does not end the flags
+	p, _ := plugins.ParseParams("--name web --hostname nginx -d --restart always -v /srv:/usr/share/nginx nginx nginx -g 'daemon off;'")
+	spec.Expect(unitJoin(runArgs(p))).ToEqual(`--name web -h nginx -v /srv:/usr/share/nginx nginx nginx -g "daemon off;"`)
+
+	api := utilities.Spec(t).ExpectString(string(files[1].Content))
+	api.ToContain("After=demo-db-mongo.service\nRequires=demo-db-mongo.service\n")
+	api.ToContain(`-h "{{ box_hostname }}"`)
+
+	files, _, _ = Exporters["systemd"].Export(sc, actions)
+	spec.Expect(strings.Contains(string(files[0].Content), "X-Fleet")).ToEqual(false)
+}
@@ -0,0 +1,267 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+type kubernetes struct{}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+var invalidKey = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// dnsName turns a name into a DNS-1123 label Kubernetes accepts.
+func dnsName(name string) string {
+	name = strings.Trim(invalidName.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+func (e *kubernetes) Export(sc *parser.Scenario, actions []*plugins.Action) ([]*File, []string, error) {
+	warnings := []string{}
+	services := map[string]string{}
+	for _, a := range actions {
+		for _, c := range a.Containers {
+			services[c.Name] = dnsName(a.Name)
+		}
+	}
+	servicePorts := map[string]yamlList{}
+	var docs []yamlMap
+	type alias struct {
+		name, service string
+		labels        yamlMap
+	}
+	var aliases []alias
+	emitted := map[string]bool{}
+
+	for _, a := range actions {
+		name := dnsName(a.Name)
+		labels := yamlMap{
+			{"app", name},
+			{"hipops.io/scenario", dnsName(sc.Id)},
+			{"hipops.io/env", dnsName(sc.Env)},
+		}
+		metadata := func(n string) yamlMap {
+			return yamlMap{{"name", n}, {"labels", labels}}
+		}
+		containers, podVolumes := yamlList{}, yamlList{}
+		configData, secretData := yamlMap{}, yamlMap{}
+		ports, seenPorts := yamlList{}, map[int]bool{}
+		addPort := func(port int, protocol string) {
+			if seenPorts[port] {
+				return
+			}
+			seenPorts[port] = true
+			ports = append(ports, yamlMap{
+				{"name", fmt.Sprintf("port-%d", port)},
+				{"port", port},
+				{"targetPort", port},
+				{"protocol", protocol},
+			})
+		}
+		replicas := 1
+		for _, c := range a.Containers {
+			switch c.State {
+			case utilities.ABSENT_APP_STATE:
+				warnings = append(warnings, fmt.Sprintf("%s: container is absent and is not exported", c.Name))
+				continue
+			case utilities.STOPPED_APP_STATE:
+				replicas = 0
+			}
+			if hasHostFacts(c) {
+				warnings = append(warnings, fmt.Sprintf("%s: host facts in params are kept as written", c.Name))
+			}
+			p, err := plugins.ParseParams(c.Params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", c.Name, err)
+			}
+			container := yamlMap{{"name", dnsName(c.Name)}, {"image", p.Image}}
+			if len(p.Cmd) != 0 {
+				container = append(container, yamlItem{"args", toList(p.Cmd)})
+			}
+			if p.Workdir != "" {
+				container = append(container, yamlItem{"workingDir", p.Workdir})
+			}
+			env := yamlList{}
+			for _, v := range p.Env {
+				kv := strings.SplitN(v, "=", 2)
+				if len(kv) != 2 {
+					warnings = append(warnings, fmt.Sprintf("%s: -e %s takes its value from the host and is not exported", c.Name, v))
+					continue
+				}
+				env = append(env, yamlMap{{"name", kv[0]}, {"value", kv[1]}})
+			}
+			if len(env) != 0 {
+				container = append(container, yamlItem{"env", env})
+			}
+			containerPorts := yamlList{}
+			for _, port := range p.Ports {
+				parts := strings.Split(port, ":")
+				target, protocol := parts[len(parts)-1], "TCP"
+				if i := strings.Index(target, "/"); i > 0 {
+					target, protocol = target[:i], strings.ToUpper(target[i+1:])
+				}
+				number, err := strconv.Atoi(target)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("%s: -p %s cannot be represented in kubernetes", c.Name, port))
+					continue
+				}
+				containerPorts = append(containerPorts, yamlMap{{"containerPort", number}, {"protocol", protocol}})
+				addPort(number, protocol)
+			}
+			if len(containerPorts) != 0 {
+				container = append(container, yamlItem{"ports", containerPorts})
+			}
+
+			mounts, volumes := yamlList{}, make([]mount, len(p.Volumes))
+			for i, v := range p.Volumes {
+				volumes[i] = parseVolume(v)
+				volumeName := fmt.Sprintf("%s-volume-%d", dnsName(c.Name), i)
+				mounts = append(mounts, yamlMap{{"name", volumeName}, {"mountPath", volumes[i].Target}, {"readOnly", volumes[i].ReadOnly}})
+				podVolumes = append(podVolumes, yamlMap{{"name", volumeName}, {"hostPath", yamlMap{{"path", volumes[i].Source}}}})
+			}
+			files, missing := customizationMounts(a, volumes)
+			warnings = append(warnings, missing...)
+			for _, f := range files {
+				content, err := ioutil.ReadFile(f.Source)
+				if err != nil {
+					return nil, nil, err
+				}
+				key := fmt.Sprintf("%d-%s", len(configData)+len(secretData), invalidKey.ReplaceAllString(path.Base(f.Target), "-"))
+				volumeName := name + "-files"
+				if f.File.Secret {
+					volumeName = name + "-secrets"
+					secretData = append(secretData, yamlItem{key, base64.StdEncoding.EncodeToString(content)})
+				} else {
+					configData = append(configData, yamlItem{key, string(content)})
+				}
+				mounts = append(mounts, yamlMap{{"name", volumeName}, {"mountPath", f.Target}, {"subPath", key}, {"readOnly", true}})
+			}
+			if len(mounts) != 0 {
+				container = append(container, yamlItem{"volumeMounts", mounts})
+			}
+
+			for _, l := range p.Links {
+				target, name := link(l)
+				service, ok := services[target]
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("%s: --link %s does not point to a container of the scenario", c.Name, l))
+					continue
+				}
+				name = dnsName(name)
+				if name == service || emitted[name] {
+					continue
+				}
+				emitted[name] = true
+				aliases = append(aliases, alias{name: name, service: service, labels: labels})
+			}
+			if p.Hostname != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: -h %s cannot be represented in kubernetes", c.Name, p.Hostname))
+			}
+			if p.Restart != "" && p.Restart != "always" && p.Restart != "unless-stopped" {
+				warnings = append(warnings, fmt.Sprintf("%s: --restart %s cannot be represented in kubernetes", c.Name, p.Restart))
+			}
+			for _, flag := range p.Extra {
+				if strings.HasPrefix(flag, "-") {
+					warnings = append(warnings, fmt.Sprintf("%s: %s cannot be represented in kubernetes", c.Name, flag))
+				}
+			}
+			containers = append(containers, container)
+		}
+		if len(containers) == 0 {
+			continue
+		}
+		for _, port := range a.Ports {
+			addPort(port, "TCP")
+		}
+		if len(configData) != 0 {
+			podVolumes = append(podVolumes, yamlMap{{"name", name + "-files"}, {"configMap", yamlMap{{"name", name + "-files"}}}})
+			docs = append(docs, yamlMap{
+				{"apiVersion", "v1"},
+				{"kind", "ConfigMap"},
+				{"metadata", metadata(name + "-files")},
+				{"data", configData},
+			})
+		}
+		if len(secretData) != 0 {
+			podVolumes = append(podVolumes, yamlMap{{"name", name + "-secrets"}, {"secret", yamlMap{{"secretName", name + "-secrets"}}}})
+			docs = append(docs, yamlMap{
+				{"apiVersion", "v1"},
+				{"kind", "Secret"},
+				{"metadata", metadata(name + "-secrets")},
+				{"type", "Opaque"},
+				{"data", secretData},
+			})
+		}
+		podSpec := yamlMap{{"containers", containers}}
+		if len(podVolumes) != 0 {
+			podSpec = append(podSpec, yamlItem{"volumes", podVolumes})
+		}
+		docs = append(docs, yamlMap{
+			{"apiVersion", "apps/v1"},
+			{"kind", "Deployment"},
+			{"metadata", metadata(name)},
+			{"spec", yamlMap{
+				{"replicas", replicas},
+				{"selector", yamlMap{{"matchLabels", yamlMap{{"app", name}}}}},
+				{"template", yamlMap{
+					{"metadata", yamlMap{{"labels", labels}}},
+					{"spec", podSpec},
+				}},
+			}},
+		})
+		servicePorts[name] = ports
+		if len(ports) != 0 {
+			docs = append(docs, yamlMap{
+				{"apiVersion", "v1"},
+				{"kind", "Service"},
+				{"metadata", metadata(name)},
+				{"spec", yamlMap{{"selector", yamlMap{{"app", name}}}, {"ports", ports}}},
+			})
+		}
+	}
+	// a --link alias becomes another Service in front of the linked app's
+	// pods, so the alias resolves through cluster DNS like it did in docker.
+	for _, a := range aliases {
+		if len(servicePorts[a.service]) == 0 {
+			warnings = append(warnings, fmt.Sprintf("link alias %s points to %s, which exposes no ports", a.name, a.service))
+			continue
+		}
+		docs = append(docs, yamlMap{
+			{"apiVersion", "v1"},
+			{"kind", "Service"},
+			{"metadata", yamlMap{{"name", a.name}, {"labels", a.labels}}},
+			{"spec", yamlMap{{"selector", yamlMap{{"app", a.service}}}, {"ports", servicePorts[a.service]}}},
+		})
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# Generated by hipops from scenario %s (%s).\n", sc.Id, sc.Env)
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.WriteString(doc.String())
+	}
+	return []*File{{Name: "kubernetes.yml", Content: buf.Bytes()}}, warnings, nil
+}
+
+func toList(items []string) yamlList {
+	list := make(yamlList, len(items))
+	for i, item := range items {
+		list[i] = item
+	}
+	return list
+}
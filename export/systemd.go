@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/aminjam/hipops/parser"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+// systemd writes a unit per container. With fleet set, every unit also
+// gets an [X-Fleet] section scheduling it on the playbook's inventory.
+type systemd struct {
+	fleet bool
+}
+
+func (e *systemd) Export(sc *parser.Scenario, actions []*plugins.Action) ([]*File, []string, error) {
+	files, warnings := []*File{}, []string{}
+	containers := map[string]bool{}
+	for _, a := range actions {
+		for _, c := range a.Containers {
+			containers[c.Name] = c.State != utilities.ABSENT_APP_STATE
+		}
+	}
+	for _, a := range actions {
+		for _, c := range a.Containers {
+			if c.State == utilities.ABSENT_APP_STATE {
+				warnings = append(warnings, fmt.Sprintf("%s: container is absent and is not exported", c.Name))
+				continue
+			}
+			if hasHostFacts(c) {
+				warnings = append(warnings, fmt.Sprintf("%s: host facts in params are kept as written", c.Name))
+			}
+			p, err := plugins.ParseParams(c.Params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", c.Name, err)
+			}
+			run := runArgs(p)
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "# Generated by hipops from scenario %s (%s).\n", sc.Id, sc.Env)
+			fmt.Fprintf(buf, "[Unit]\nDescription=%s\nAfter=docker.service\nRequires=docker.service\n", unitEscape(a.Name))
+			for _, l := range p.Links {
+				target, _ := link(l)
+				if !containers[target] {
+					warnings = append(warnings, fmt.Sprintf("%s: --link %s does not point to a container of the scenario", c.Name, l))
+					continue
+				}
+				fmt.Fprintf(buf, "After=%s.service\nRequires=%s.service\n", target, target)
+			}
+			restart := "always"
+			switch p.Restart {
+			case "", "always", "unless-stopped":
+			case "no":
+				restart = "no"
+			default:
+				restart = "on-failure"
+			}
+			fmt.Fprintf(buf, "\n[Service]\nTimeoutStartSec=0\nRestart=%s\n", restart)
+			fmt.Fprintf(buf, "ExecStartPre=-/usr/bin/docker kill %s\n", c.Name)
+			fmt.Fprintf(buf, "ExecStartPre=-/usr/bin/docker rm %s\n", c.Name)
+			fmt.Fprintf(buf, "ExecStartPre=/usr/bin/docker pull %s\n", unitQuote(p.Image))
+			if p.Network != "" {
+				fmt.Fprintf(buf, "ExecStartPre=-/usr/bin/docker network create %s\n", unitQuote(p.Network))
+			}
+			for _, n := range c.Connect {
+				warnings = append(warnings, fmt.Sprintf("%s: network %s besides --network %s is not exported", c.Name, n.Name, p.Network))
+			}
+			fmt.Fprintf(buf, "ExecStart=/usr/bin/docker run %s\n", unitJoin(run))
+			fmt.Fprintf(buf, "ExecStop=/usr/bin/docker stop %s\n", c.Name)
+			if c.State == utilities.STOPPED_APP_STATE {
+				warnings = append(warnings, fmt.Sprintf("%s: stopped container is exported without [Install]", c.Name))
+			} else {
+				fmt.Fprintf(buf, "\n[Install]\nWantedBy=multi-user.target\n")
+			}
+			if e.fleet {
+				fmt.Fprintf(buf, "\n[X-Fleet]\nMachineMetadata=inventory=%s\n", unitEscape(a.Inventory))
+			}
+			files = append(files, &File{Name: c.Name + ".service", Content: buf.Bytes()})
+		}
+	}
+	return files, warnings, nil
+}
+
+// runArgs is the `docker run` argv of the unit. The unit runs the container
+// in the foreground and restarts it itself, so -d and --restart are left out.
+func runArgs(p *plugins.RunParams) []string {
+	args := []string{}
+	flag := func(name string, values ...string) {
+		for _, v := range values {
+			if v != "" {
+				args = append(args, name, v)
+			}
+		}
+	}
+	flag("--name", p.Name)
+	flag("-h", p.Hostname)
+	flag("-w", p.Workdir)
+	flag("-v", p.Volumes...)
+	flag("-p", p.Ports...)
+	flag("-e", p.Env...)
+	flag("--network", p.Network)
+	flag("--network-alias", p.NetworkAliases...)
+	flag("--link", p.Links...)
+	args = append(args, p.Extra...)
+	args = append(args, p.Image)
+	return append(args, p.Cmd...)
+}
+
+// unitEscape protects the specifiers and variables systemd would expand.
+func unitEscape(s string) string {
+	return strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+}
+
+func unitQuote(arg string) string {
+	arg = unitEscape(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func unitJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = unitQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// yamlMap and yamlList build YAML documents whose keys keep their order,
+// so the exported files are stable between runs.
+type yamlMap []yamlItem
+type yamlList []interface{}
+
+type yamlItem struct {
+	Key   string
+	Value interface{}
+}
+
+func (m yamlMap) String() string {
+	buf := new(bytes.Buffer)
+	m.write(buf, 0, "")
+	return buf.String()
+}
+
+func (m yamlMap) write(buf *bytes.Buffer, indent int, first string) {
+	for i, item := range m {
+		pad := strings.Repeat(" ", indent)
+		if i == 0 && first != "" {
+			pad = first
+		}
+		switch v := item.Value.(type) {
+		case yamlMap:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s%s: {}\n", pad, item.Key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, item.Key)
+			v.write(buf, indent+2, "")
+		case yamlList:
+			if len(v) == 0 {
+				fmt.Fprintf(buf, "%s%s: []\n", pad, item.Key)
+				continue
+			}
+			fmt.Fprintf(buf, "%s%s:\n", pad, item.Key)
+			v.write(buf, indent+2)
+		default:
+			fmt.Fprintf(buf, "%s%s: %s\n", pad, item.Key, scalar(v))
+		}
+	}
+}
+
+func (l yamlList) write(buf *bytes.Buffer, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, v := range l {
+		if m, ok := v.(yamlMap); ok && len(m) != 0 {
+			m.write(buf, indent+2, pad+"- ")
+			continue
+		}
+		fmt.Fprintf(buf, "%s- %s\n", pad, scalar(v))
+	}
+}
+
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return quote(v)
+	case yamlMap:
+		return "{}"
+	}
+	return fmt.Sprint(v)
+}
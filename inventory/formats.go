@@ -0,0 +1,146 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+type yamlGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]*yamlGroup             `yaml:"children"`
+}
+
+// ParseYAML reads an Ansible static inventory in YAML format.
+func ParseYAML(content []byte) (*Inventory, error) {
+	var groups map[string]*yamlGroup
+	if err := yaml.Unmarshal(content, &groups); err != nil {
+		return nil, err
+	}
+	inv := New()
+	for _, name := range groupNames(groups) {
+		inv.addYAMLGroup(name, groups[name])
+	}
+	return inv, nil
+}
+
+func (inv *Inventory) addYAMLGroup(name string, g *yamlGroup) {
+	inv.AddGroup(name)
+	if g == nil {
+		return
+	}
+	hosts := make([]string, 0, len(g.Hosts))
+	for host := range g.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		inv.AddHost(name, host, stringVars(g.Hosts[host]))
+	}
+	for k, v := range stringVars(g.Vars) {
+		inv.SetGroupVar(name, k, v)
+	}
+	for _, child := range groupNames(g.Children) {
+		if name != "all" {
+			inv.AddChild(name, child)
+		}
+		inv.addYAMLGroup(child, g.Children[child])
+	}
+}
+
+// ParseJSON reads the `--list` output of a dynamic inventory script, which
+// is also accepted as a static JSON inventory.
+func ParseJSON(content []byte) (*Inventory, error) {
+	var groups map[string]json.RawMessage
+	if err := json.Unmarshal(content, &groups); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	inv := New()
+	for _, name := range names {
+		if name == "_meta" {
+			continue
+		}
+		var hosts []string
+		if json.Unmarshal(groups[name], &hosts) == nil {
+			inv.AddGroup(name)
+			for _, host := range hosts {
+				inv.AddHost(name, host, nil)
+			}
+			continue
+		}
+		var g struct {
+			Hosts    []string
+			Vars     map[string]interface{}
+			Children []string
+		}
+		if err := json.Unmarshal(groups[name], &g); err != nil {
+			return nil, fmt.Errorf("inventory group %s: %s", name, err)
+		}
+		inv.AddGroup(name)
+		for _, host := range g.Hosts {
+			inv.AddHost(name, host, nil)
+		}
+		for k, v := range stringVars(g.Vars) {
+			inv.SetGroupVar(name, k, v)
+		}
+		for _, child := range g.Children {
+			inv.AddChild(name, child)
+		}
+	}
+	var meta struct {
+		Hostvars map[string]map[string]interface{}
+	}
+	if raw, ok := groups["_meta"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("inventory _meta: %s", err)
+		}
+	}
+	for host, vars := range meta.Hostvars {
+		if h, ok := inv.hosts[host]; ok {
+			for k, v := range stringVars(vars) {
+				h.Vars[k] = v
+			}
+		}
+	}
+	return inv, nil
+}
+
+// runDynamic runs an executable inventory with --list.
+func runDynamic(path string) (*Inventory, error) {
+	cmd := exec.Command(path, "--list")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dynamic inventory %s: %s", path, err)
+	}
+	return ParseJSON(out)
+}
+
+func stringVars(vars map[string]interface{}) map[string]string {
+	out := map[string]string{}
+	for k, v := range vars {
+		if v != nil {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+func groupNames(groups map[string]*yamlGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,459 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const DEFAULT_SSH_PORT = 22
+
+type Host struct {
+	Name, Address string
+	Port          int
+	Vars          map[string]string
+}
+
+// User returns the remote user set for the host in the inventory, if any.
+func (h *Host) User() string {
+	if u := h.Vars["ansible_user"]; u != "" {
+		return u
+	}
+	return h.Vars["ansible_ssh_user"]
+}
+
+func (h *Host) Addr() string {
+	return fmt.Sprintf("%s:%d", h.Address, h.Port)
+}
+
+type Inventory struct {
+	hosts    map[string]*Host
+	groups   map[string][]string
+	children map[string][]string
+	vars     map[string]map[string]string
+}
+
+func New() *Inventory {
+	return &Inventory{
+		hosts:    map[string]*Host{},
+		groups:   map[string][]string{},
+		children: map[string][]string{},
+		vars:     map[string]map[string]string{},
+	}
+}
+
+// Load reads an inventory file. Executable files are run as dynamic
+// inventories; .yml, .yaml and .json files are read in those formats and
+// anything else as INI.
+func Load(path string) (*Inventory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0 {
+		return runDynamic(path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		return ParseYAML(content)
+	case ".json":
+		return ParseJSON(content)
+	}
+	return ParseINI(bytes.NewReader(content))
+}
+
+// ParseINI reads an Ansible static inventory in INI format.
+func ParseINI(r io.Reader) (*Inventory, error) {
+	inv := New()
+	group, section := "ungrouped", ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("inventory line %d: invalid section %s", n, line)
+			}
+			group, section = strings.Trim(line, "[]"), ""
+			if i := strings.Index(group, ":"); i > 0 {
+				group, section = group[:i], group[i+1:]
+			}
+			inv.AddGroup(group)
+			continue
+		}
+		// a vars line is one key=value, whatever its value holds
+		if section == "vars" {
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("inventory line %d: expected key=value", n)
+			}
+			inv.SetGroupVar(group, strings.TrimSpace(kv[0]), strings.Trim(strings.TrimSpace(kv[1]), `"'`))
+			continue
+		}
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("inventory line %d: %s", n, err)
+		}
+		switch section {
+		case "children":
+			inv.AddChild(group, fields[0])
+		case "":
+			names, err := expandHosts(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("inventory line %d: %s", n, err)
+			}
+			vars := map[string]string{}
+			for _, f := range fields[1:] {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("inventory line %d: expected key=value, got %s", n, f)
+				}
+				vars[kv[0]] = kv[1]
+			}
+			for _, name := range names {
+				inv.AddHost(group, name, vars)
+			}
+		default:
+			return nil, fmt.Errorf("inventory line %d: unknown section %s", n, section)
+		}
+	}
+	return inv, scanner.Err()
+}
+
+func (inv *Inventory) AddGroup(group string) {
+	if _, ok := inv.groups[group]; !ok {
+		inv.groups[group] = nil
+	}
+}
+
+func (inv *Inventory) AddChild(group, child string) {
+	inv.AddGroup(group)
+	inv.AddGroup(child)
+	inv.children[group] = append(inv.children[group], child)
+}
+
+func (inv *Inventory) SetGroupVar(group, key, value string) {
+	inv.AddGroup(group)
+	if inv.vars[group] == nil {
+		inv.vars[group] = map[string]string{}
+	}
+	inv.vars[group][key] = value
+}
+
+func (inv *Inventory) AddHost(group, name string, vars map[string]string) {
+	inv.AddGroup(group)
+	host, ok := inv.hosts[name]
+	if !ok {
+		host = &Host{Name: name, Vars: map[string]string{}}
+		inv.hosts[name] = host
+	}
+	for k, v := range vars {
+		host.Vars[k] = v
+	}
+	for _, h := range inv.groups[group] {
+		if h == name {
+			return
+		}
+	}
+	inv.groups[group] = append(inv.groups[group], name)
+}
+
+func (inv *Inventory) HasGroup(group string) bool {
+	if group == "all" {
+		return true
+	}
+	_, ok := inv.groups[group]
+	return ok
+}
+
+func (inv *Inventory) Groups() []string {
+	groups := make([]string, 0, len(inv.groups))
+	for g := range inv.groups {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Hosts resolves a group, including its children, to hosts with their
+// group vars applied and their address and port filled in.
+func (inv *Inventory) Hosts(group string) ([]*Host, error) {
+	if !inv.HasGroup(group) {
+		return nil, fmt.Errorf("inventory group %s is not found", group)
+	}
+	var names []string
+	if group == "all" {
+		for name := range inv.hosts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else {
+		names = inv.members(group, map[string]bool{})
+	}
+	hosts, seen := []*Host{}, map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		hosts = append(hosts, inv.resolve(inv.hosts[name]))
+	}
+	return hosts, nil
+}
+
+func (inv *Inventory) members(group string, visited map[string]bool) []string {
+	if visited[group] {
+		return nil
+	}
+	visited[group] = true
+	names := append([]string{}, inv.groups[group]...)
+	for _, child := range inv.children[group] {
+		names = append(names, inv.members(child, visited)...)
+	}
+	return names
+}
+
+// resolve applies vars in Ansible's order: all, then the host's groups
+// from the top-level ones down to the ones it is listed in, then its own.
+func (inv *Inventory) resolve(h *Host) *Host {
+	host := &Host{Name: h.Name, Vars: map[string]string{}}
+	for k, v := range inv.vars["all"] {
+		host.Vars[k] = v
+	}
+	for _, g := range inv.groupsOf(h.Name) {
+		for k, v := range inv.vars[g] {
+			host.Vars[k] = v
+		}
+	}
+	for k, v := range h.Vars {
+		host.Vars[k] = v
+	}
+	host.Address = h.Name
+	for _, k := range []string{"ansible_host", "ansible_ssh_host"} {
+		if host.Vars[k] != "" {
+			host.Address = host.Vars[k]
+			break
+		}
+	}
+	host.Port = DEFAULT_SSH_PORT
+	for _, k := range []string{"ansible_port", "ansible_ssh_port"} {
+		if port, err := strconv.Atoi(host.Vars[k]); err == nil {
+			host.Port = port
+			break
+		}
+	}
+	return host
+}
+
+// groupsOf lists the groups a host is in, directly or through a child
+// group, ordered by depth and then by name.
+func (inv *Inventory) groupsOf(name string) []string {
+	parents := map[string][]string{}
+	for g, children := range inv.children {
+		for _, child := range children {
+			parents[child] = append(parents[child], g)
+		}
+	}
+	seen := map[string]bool{}
+	var collect func(string)
+	collect = func(g string) {
+		if seen[g] || g == "all" {
+			return
+		}
+		seen[g] = true
+		for _, parent := range parents[g] {
+			collect(parent)
+		}
+	}
+	for g, names := range inv.groups {
+		for _, n := range names {
+			if n == name {
+				collect(g)
+			}
+		}
+	}
+	depths := map[string]int{}
+	var depth func(string, map[string]bool) int
+	depth = func(g string, visiting map[string]bool) int {
+		if d, ok := depths[g]; ok {
+			return d
+		}
+		if visiting[g] {
+			return 0
+		}
+		visiting[g] = true
+		d := 0
+		for _, parent := range parents[g] {
+			if parent != "all" {
+				if pd := depth(parent, visiting) + 1; pd > d {
+					d = pd
+				}
+			}
+		}
+		depths[g] = d
+		return d
+	}
+	groups := make([]string, 0, len(seen))
+	for g := range seen {
+		groups = append(groups, g)
+		depth(g, map[string]bool{})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if depths[groups[i]] != depths[groups[j]] {
+			return depths[groups[i]] < depths[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+	return groups
+}
+
+// splitFields splits a host line on spaces outside of quotes, dropping the
+// quotes, so `k="a b"` stays one field.
+// hostRange matches the first `[start:end]` or `[start:end:stride]` of a
+// host pattern.
+var hostRange = regexp.MustCompile(`\[([0-9]*|[a-zA-Z]):([0-9]+|[a-zA-Z])(?::([0-9]+))?\]`)
+
+// expandHosts expands the ranges of a host pattern the way Ansible does:
+// web[01:03] is web01, web02 and web03, and db-[a:c] is db-a, db-b and
+// db-c. A numeric start with a leading zero pads every number to its
+// width.
+func expandHosts(pattern string) ([]string, error) {
+	m := hostRange.FindStringSubmatchIndex(pattern)
+	if m == nil {
+		if strings.ContainsAny(pattern, "[]") {
+			return nil, fmt.Errorf("invalid host range %s", pattern)
+		}
+		return []string{pattern}, nil
+	}
+	head, tail := pattern[:m[0]], pattern[m[1]:]
+	start, end, stride := pattern[m[2]:m[3]], pattern[m[4]:m[5]], 1
+	if m[6] >= 0 {
+		stride, _ = strconv.Atoi(pattern[m[6]:m[7]])
+	}
+	if stride < 1 {
+		return nil, fmt.Errorf("invalid host range %s: stride must be positive", pattern)
+	}
+	items := []string{}
+	if from, err := strconv.Atoi(start); err == nil || start == "" {
+		to, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host range %s", pattern)
+		}
+		format := "%d"
+		if len(start) > 1 && start[0] == '0' {
+			if len(start) != len(end) {
+				return nil, fmt.Errorf("invalid host range %s: padded start and end differ in length", pattern)
+			}
+			format = fmt.Sprintf("%%0%dd", len(start))
+		}
+		for i := from; i <= to; i += stride {
+			items = append(items, fmt.Sprintf(format, i))
+		}
+	} else if len(end) == 1 && !unicode.IsDigit(rune(end[0])) {
+		for c := int(start[0]); c <= int(end[0]); c += stride {
+			items = append(items, string(rune(c)))
+		}
+	} else {
+		return nil, fmt.Errorf("invalid host range %s", pattern)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("invalid host range %s: start is after end", pattern)
+	}
+	rest, err := expandHosts(tail)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, item := range items {
+		for _, r := range rest {
+			names = append(names, head+item+r)
+		}
+	}
+	return names, nil
+}
+
+func splitFields(line string) ([]string, error) {
+	fields := []string{}
+	var field strings.Builder
+	inField, quote := false, rune(0)
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// WriteINI writes the inventory in Ansible's INI format.
+func (inv *Inventory) WriteINI(w io.Writer) error {
+	for _, group := range inv.Groups() {
+		if _, err := fmt.Fprintf(w, "[%s]\n", group); err != nil {
+			return err
+		}
+		for _, name := range inv.groups[group] {
+			fmt.Fprintf(w, "%s%s\n", name, formatVars(inv.hosts[name].Vars, " "))
+		}
+		if len(inv.children[group]) != 0 {
+			fmt.Fprintf(w, "\n[%s:children]\n%s\n", group, strings.Join(inv.children[group], "\n"))
+		}
+		if len(inv.vars[group]) != 0 {
+			fmt.Fprintf(w, "\n[%s:vars]%s\n", group, formatVars(inv.vars[group], "\n"))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func formatVars(vars map[string]string, sep string) string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := ""
+	for _, k := range keys {
+		v := vars[k]
+		if strings.ContainsAny(v, " \t'\"") || v == "" {
+			v = strconv.Quote(v)
+		}
+		out += fmt.Sprintf("%s%s=%s", sep, k, v)
+	}
+	return out
+}
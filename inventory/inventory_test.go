@@ -0,0 +1,164 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+const hosts = `
+# local vagrant boxes
+[web]
+web1 ansible_ssh_host=10.0.0.2 ansible_ssh_port=2222
+web2 ansible_host=10.0.0.3 ansible_user=ubuntu
+
+[db]
+db1
+
+[demo:children]
+web
+db
+
+[demo:vars]
+ansible_user=core
+`
+
+func TestInventory_ParseINI(t *testing.T) {
+	spec := utilities.Spec(t)
+	inv, err := ParseINI(strings.NewReader(hosts))
+	spec.Expect(err).ToEqual(nil)
+
+	web, err := inv.Hosts("web")
+	spec.Expect(err, len(web)).ToEqual(nil, 2)
+	spec.Expect(web[0].Addr(), web[1].Addr()).ToEqual("10.0.0.2:2222", "10.0.0.3:22")
+	spec.Expect(web[1].User()).ToEqual("ubuntu")
+
+	demo, err := inv.Hosts("demo")
+	spec.Expect(err, len(demo)).ToEqual(nil, 3)
+	spec.Expect(demo[0].User(), demo[1].User(), demo[2].Name).ToEqual("core", "ubuntu", "db1")
+
+	_, err = inv.Hosts("tag_App-Role_DEMO")
+	spec.ExpectString(err.Error()).ToContain("tag_App-Role_DEMO")
+
+	_, err = ParseINI(strings.NewReader("[web]\nweb1 port"))
+	spec.ExpectString(err.Error()).ToContain("line 2")
+}
+
+func TestInventory_ParseINIRanges(t *testing.T) {
+	spec := utilities.Spec(t)
+	inv, err := ParseINI(strings.NewReader("[web]\nweb[01:03].example.com ansible_user=deploy\ndb-[a:c:2]\nnode[8:10]\n\n[web:vars]\nmotd=it's up\n"))
+	spec.Expect(err).ToEqual(nil)
+	web, _ := inv.Hosts("web")
+	names := []string{}
+	for _, h := range web {
+		names = append(names, h.Name)
+	}
+	spec.Expect(strings.Join(names, " ")).ToEqual("web01.example.com web02.example.com web03.example.com db-a db-c node8 node9 node10")
+	spec.Expect(web[2].User(), web[3].Vars["motd"]).ToEqual("deploy", "it's up")
+
+	_, err = ParseINI(strings.NewReader("[web]\nweb[01:100]\n"))
+	spec.ExpectString(err.Error()).ToContain("line 2: invalid host range web[01:100]")
+	_, err = ParseINI(strings.NewReader("[web]\nweb[3:1]\n"))
+	spec.ExpectString(err.Error()).ToContain("start is after end")
+}
+
+func TestInventory_GroupVarsPrecedence(t *testing.T) {
+	const nested = `
+[web]
+w1
+
+[web:vars]
+ansible_port=2222
+ansible_user=deploy
+
+[prod:children]
+web
+
+[prod:vars]
+ansible_user=core
+region=eu
+
+[all:vars]
+region=us
+timeout=10
+`
+	spec := utilities.Spec(t)
+	inv, err := ParseINI(strings.NewReader(nested))
+	spec.Expect(err).ToEqual(nil)
+	for _, group := range []string{"web", "prod", "all"} {
+		hosts, err := inv.Hosts(group)
+		spec.Expect(err, len(hosts)).ToEqual(nil, 1)
+		spec.Expect(hosts[0].Addr(), hosts[0].User()).ToEqual("w1:2222", "deploy")
+		spec.Expect(hosts[0].Vars["region"], hosts[0].Vars["timeout"]).ToEqual("eu", "10")
+	}
+}
+
+func TestInventory_WriteINI(t *testing.T) {
+	spec := utilities.Spec(t)
+	inv, _ := ParseINI(strings.NewReader(hosts))
+	inv.AddHost("web", "web3", map[string]string{"ansible_python_interpreter": "PATH=/home/core/bin:$PATH python"})
+	out := new(strings.Builder)
+	spec.Expect(inv.WriteINI(out)).ToEqual(nil)
+
+	again, err := ParseINI(strings.NewReader(out.String()))
+	spec.Expect(err).ToEqual(nil)
+	web, _ := again.Hosts("demo")
+	spec.Expect(len(web), web[2].Vars["ansible_python_interpreter"]).ToEqual(4, "PATH=/home/core/bin:$PATH python")
+	spec.Expect(web[0].User(), web[0].Addr()).ToEqual("core", "10.0.0.2:2222")
+}
+
+const yamlHosts = `
+all:
+  hosts:
+    web1:
+      ansible_host: 10.0.0.2
+      ansible_port: 2222
+  children:
+    web:
+      hosts:
+        web1:
+        web2:
+          ansible_host: 10.0.0.3
+      vars:
+        ansible_user: core
+    empty: {}
+`
+
+func TestInventory_ParseYAML(t *testing.T) {
+	spec := utilities.Spec(t)
+	inv, err := ParseYAML([]byte(yamlHosts))
+	spec.Expect(err).ToEqual(nil)
+
+	web, err := inv.Hosts("web")
+	spec.Expect(err, len(web)).ToEqual(nil, 2)
+	spec.Expect(web[0].Addr(), web[1].Addr(), web[1].User()).ToEqual("10.0.0.2:2222", "10.0.0.3:22", "core")
+
+	empty, err := inv.Hosts("empty")
+	spec.Expect(err, len(empty)).ToEqual(nil, 0)
+}
+
+const dynamicHosts = `{
+  "tag_App-Role_DEMO": {"hosts": ["10.0.0.2"], "vars": {"ansible_user": "ubuntu"}},
+  "ec2": ["10.0.0.2", "10.0.0.3"],
+  "_meta": {"hostvars": {"10.0.0.3": {"ansible_port": 2222}}}
+}`
+
+func TestInventory_Dynamic(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-inventory")
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "ec2.sh")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = \"--list\" ] && cat <<'EOF'\n"+dynamicHosts+"\nEOF\n"), 0755)
+
+	inv, err := Load(script)
+	spec.Expect(err).ToEqual(nil)
+	demo, _ := inv.Hosts("tag_App-Role_DEMO")
+	spec.Expect(len(demo), demo[0].User()).ToEqual(1, "ubuntu")
+	ec2, _ := inv.Hosts("ec2")
+	spec.Expect(len(ec2), ec2[1].Addr()).ToEqual(2, "10.0.0.3:2222")
+	spec.Expect(inv.HasGroup("tag_App-Role_DEMO-typo")).ToEqual(false)
+}
@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aminjam/hipops/inventory"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+var addrRef = regexp.MustCompile(`@ADDR\(([^:()]+):([0-9]+)\)`)
+
+// addr is the `addr` template function. It checks the app exists and
+// returns the placeholder the parser carries in the container params until
+// every playbook is parsed and resolveAddrs replaces it.
+func (sc *Scenario) addr(name string, port int) (string, error) {
+	if _, err := sc.lookupApp(name); err != nil {
+		return "", fmt.Errorf("%s %s", utilities.UNRESOLVED_ADDR, err)
+	}
+	if port <= 0 || port > 65535 {
+		return "", fmt.Errorf("%s %s: port %d", utilities.UNRESOLVED_ADDR, name, port)
+	}
+	return fmt.Sprintf("@ADDR(%s:%d)", name, port), nil
+}
+
+// lookupApp finds the one app with name as its declared or configured
+// name.
+func (sc *Scenario) lookupApp(name string) (*app, error) {
+	var found []*app
+	for _, a := range sc.Apps {
+		if a.ref == name || a.Name == name {
+			found = append(found, a)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("app %s is not found", name)
+	case 1:
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, a := range found {
+		names[i] = a.Name
+	}
+	return nil, fmt.Errorf("app %s matches several apps: %s", name, strings.Join(names, ", "))
+}
+
+// AppName is the configured name of the app declared or configured as
+// name, which actions carry as their Name.
+func (sc *Scenario) AppName(name string) (string, error) {
+	a, err := sc.lookupApp(name)
+	if err != nil {
+		return "", err
+	}
+	return a.Name, nil
+}
+
+// resolveAddrs replaces the addr placeholders of every container with the
+// host and port the app is reachable at from other hosts. The host is the
+// app's own host or else the first host of the inventory group of the
+// playbook that deploys it, and the port the one its container publishes.
+func (sc *Scenario) resolveAddrs(actions []*plugins.Action, inv *inventory.Inventory) error {
+	hosts := func(group string) ([]*inventory.Host, error) {
+		if inv == nil {
+			if sc.InventoryFile == "" {
+				return nil, errors.New("the scenario has no hosts and no inventory file")
+			}
+			file, err := inventory.Load(sc.InventoryFile)
+			if err != nil {
+				return nil, err
+			}
+			inv = file
+		}
+		return inv.Hosts(group)
+	}
+	for _, a := range actions {
+		for _, c := range a.Containers {
+			var err error
+			c.Params = addrRef.ReplaceAllStringFunc(c.Params, func(ref string) string {
+				m := addrRef.FindStringSubmatch(ref)
+				port, _ := strconv.Atoi(m[2])
+				target, e := sc.lookupApp(m[1])
+				resolved := ref
+				if e == nil {
+					resolved, e = sc.resolveAddr(actions, target, port, hosts)
+				}
+				if e != nil && err == nil {
+					err = fmt.Errorf("%s %s: %s", utilities.UNRESOLVED_ADDR, c.Name, e)
+				}
+				return resolved
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sc *Scenario) resolveAddr(actions []*plugins.Action, target *app, port int, hosts func(string) ([]*inventory.Host, error)) (string, error) {
+	host, published, deployed := target.Host, "", false
+	for _, a := range actions {
+		if a.Name != target.Name {
+			continue
+		}
+		deployed = true
+		if host == "" {
+			resolved, err := hosts(a.Inventory)
+			if err != nil {
+				return "", fmt.Errorf("%s: %s", target.ref, err)
+			}
+			if len(resolved) == 0 {
+				return "", fmt.Errorf("%s: inventory group %s has no hosts", target.ref, a.Inventory)
+			}
+			host = resolved[0].Address
+		}
+		for _, c := range a.Containers {
+			if published == "" {
+				published = publishedPort(c, port)
+			}
+		}
+	}
+	switch {
+	case !deployed && host == "":
+		return "", fmt.Errorf("%s is not deployed by any playbook and has no host", target.ref)
+	case !deployed:
+		published = strconv.Itoa(port)
+	case published == "":
+		return "", fmt.Errorf("%s does not publish port %d", target.ref, port)
+	}
+	return fmt.Sprintf("%s:%s", host, published), nil
+}
+
+// publishedPort is the host port other hosts reach the container's port
+// on, empty when the container does not publish it beyond loopback.
+func publishedPort(c *plugins.Container, port int) string {
+	p, err := plugins.ParseParams(c.Params)
+	if err != nil {
+		return ""
+	}
+	if p.Network == "host" {
+		return strconv.Itoa(port)
+	}
+	for _, mapping := range p.Ports {
+		parts := strings.Split(mapping, ":")
+		container := strings.TrimSuffix(parts[len(parts)-1], "/tcp")
+		if len(parts) < 2 || container != strconv.Itoa(port) {
+			continue
+		}
+		if len(parts) == 3 && (parts[0] == "localhost" || strings.HasPrefix(parts[0], "127.")) {
+			continue
+		}
+		if published := parts[len(parts)-2]; published != "" {
+			return published
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+// LOCK_FILE is the lock's name next to the scenario file.
+const LOCK_FILE = "hipops.lock"
+
+// Lock pins what a scenario deploys: every app image to a digest and every
+// repository ref to a commit.
+type Lock struct {
+	// Images maps an image as written to name@digest
+	Images map[string]string `json:"images"`
+	// Repositories maps url#ref to a commit
+	Repositories map[string]string `json:"repositories"`
+}
+
+func NewLock() *Lock {
+	return &Lock{Images: map[string]string{}, Repositories: map[string]string{}}
+}
+
+// ReadLock reads a lock written by Lock.Write.
+func ReadLock(fileName string) (*Lock, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	lock := NewLock()
+	if err = json.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("%s: %s", fileName, err)
+	}
+	return lock, nil
+}
+
+// Write saves the lock as indented JSON, so it diffs well.
+func (l *Lock) Write(fileName string) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(content, '\n'), 0644)
+}
+
+// RepositoryKey is how a repository's ref is found in the lock.
+func RepositoryKey(r *plugins.Repository) string {
+	return r.CloneUrl() + "#" + r.Ref
+}
+
+// Lockable lists the images and repositories of the scenario's apps that a
+// lock pins. Built images and images already given by digest are left out.
+func (sc *Scenario) Lockable() (images []string, repositories []*plugins.Repository) {
+	seen := map[string]bool{}
+	for _, a := range sc.Apps {
+		if a.Image != "" && a.Build == nil && !strings.Contains(a.Image, "@") && !seen[a.Image] {
+			seen[a.Image] = true
+			images = append(images, a.Image)
+		}
+		if r := a.Repository; r != nil && !r.IsCommit() && !seen[RepositoryKey(r)] {
+			seen[RepositoryKey(r)] = true
+			repositories = append(repositories, r)
+		}
+	}
+	sort.Strings(images)
+	return
+}
+
+// RegistryOf is the registry the apps with image log in to, nil for none.
+func (sc *Scenario) RegistryOf(image string) *plugins.Registry {
+	for _, a := range sc.Apps {
+		if a.Image == image && a.Registry != nil {
+			return a.Registry
+		}
+	}
+	return nil
+}
+
+// pin replaces the app's image and repository ref with the ones in the
+// scenario's lock, and records what the lock is missing.
+func (a *app) pin(sc *Scenario) {
+	if sc.Lock == nil {
+		return
+	}
+	if sc.pinned == nil {
+		sc.pinned = map[string]bool{}
+	}
+	if a.Image != "" && a.Build == nil && !strings.Contains(a.Image, "@") {
+		if pinned, ok := sc.Lock.Images[a.Image]; ok {
+			sc.pinned[a.Image] = true
+			a.Image = pinned
+		} else {
+			sc.unlocked = append(sc.unlocked, a.Image)
+		}
+	}
+	if r := a.Repository; r != nil && !r.IsCommit() {
+		if commit, ok := sc.Lock.Repositories[RepositoryKey(r)]; ok {
+			sc.pinned[RepositoryKey(r)] = true
+			r.Ref = commit
+		} else {
+			sc.unlocked = append(sc.unlocked, RepositoryKey(r))
+		}
+	}
+}
+
+// checkLock fails a locked scenario whose lock is missing, does not pin
+// everything the scenario deploys or pins what it no longer deploys.
+func (sc *Scenario) checkLock() error {
+	if !sc.Locked {
+		return nil
+	}
+	if sc.Lock == nil {
+		return fmt.Errorf("%s %s is missing, run hipops lock", utilities.STALE_LOCK, LOCK_FILE)
+	}
+	if len(sc.unlocked) != 0 {
+		return fmt.Errorf("%s %s does not pin %s, run hipops lock", utilities.STALE_LOCK, LOCK_FILE, strings.Join(sc.unlocked, ", "))
+	}
+	var extra []string
+	for _, entries := range []map[string]string{sc.Lock.Images, sc.Lock.Repositories} {
+		for key := range entries {
+			if !sc.pinned[key] {
+				extra = append(extra, key)
+			}
+		}
+	}
+	if len(extra) != 0 {
+		sort.Strings(extra)
+		return fmt.Errorf("%s %s pins %s, which the scenario does not deploy, run hipops lock", utilities.STALE_LOCK, LOCK_FILE, strings.Join(extra, ", "))
+	}
+	return nil
+}
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	gos "os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/aminjam/hipops/inventory"
 	"github.com/aminjam/hipops/plugins"
 	"github.com/aminjam/hipops/utilities"
 )
@@ -21,17 +27,31 @@ type app struct {
 	Cred           *cred
 	Customizations []*plugins.Customization
 	Repository     *plugins.Repository
+	Build          *plugins.ImageBuild
+	Registry       *plugins.Registry
+	Volumes        []*plugins.Volume
+	// Networks and Aliases are filled in from the scenario's networks
+	Networks []*plugins.Network `json:"-"`
+	Aliases  []string           `json:"-"`
+	// ref is the name the scenario declares the app with
+	ref string
 }
 
 func (a *app) toAction(action *plugins.Action) {
 	action.Dest = a.Dest
+	action.Ports = a.Ports
 	action.Repository = a.Repository
 	action.Files = a.Customizations
+	action.Build = a.Build
+	action.Registry = a.Registry
+	action.Networks = a.Networks
+	action.Volumes = a.Volumes
 }
 func (a *app) configure(sc *Scenario) error {
 	if a.Type == "" {
 		a.Type = utilities.DEFAULT_APP_TYPE
 	}
+	a.ref = a.Name
 	if a.Type != utilities.DEFAULT_APP_TYPE {
 		a.Name = fmt.Sprintf("%s-%s-%s", sc.Id, a.Type, a.Name)
 	}
@@ -39,28 +59,137 @@ func (a *app) configure(sc *Scenario) error {
 		a.Dest = fmt.Sprintf("%s/%s-%s/%s/%s", sc.Dest, sc.Id, sc.Env, a.Type, a.Name)
 	}
 	a.Dest = strings.TrimSuffix(a.Dest, "/")
+	// directories and globs are replaced by the files they ship
+	files := []*plugins.Customization{}
 	for c, _ := range a.Customizations {
-		if err := a.Customizations[c].Configure(sc.Suffix, a.Dest); err != nil {
+		if err := a.Customizations[c].Configure(sc.Workspace, sc.BaseDir, a.Dest); err != nil {
 			return err
 		}
+		expanded, err := a.Customizations[c].Expand()
+		if err != nil {
+			return err
+		}
+		files = append(files, expanded...)
 	}
+	a.Customizations = files
 	if a.Repository != nil {
 		if err := a.Repository.Configure(); err != nil {
 			return err
 		}
 	}
+	for _, v := range a.Volumes {
+		if err := v.Configure(a.Name, a.Dest, path.Join(sc.Dest, "snapshots", a.Name)); err != nil {
+			return fmt.Errorf("%s: %s", a.Name, err)
+		}
+	}
+	if a.Registry != nil {
+		if err := a.Registry.Configure(); err != nil {
+			return fmt.Errorf("%s: %s", a.Name, err)
+		}
+	}
+	a.pin(sc)
+	if a.Build != nil {
+		if a.Build.Tag == "" {
+			a.Build.Tag = a.Image
+		}
+		if err := a.Build.Configure(sc.BaseDir); err != nil {
+			return fmt.Errorf("%s: %s", a.Name, err)
+		}
+	}
 	return nil
 }
 
+// templateData is what files and build tags are rendered with: the
+// scenario fields and the app as .App.
+func (a *app) templateData(sc *Scenario) interface{} {
+	return struct {
+		*Scenario
+		App *app
+	}{sc, a}
+}
+
+// render replaces a templated customization's Src with its rendered copy
+// in the run workspace.
+func (a *app) render(sc *Scenario, c *plugins.Customization) error {
+	content, err := ioutil.ReadFile(c.Src)
+	if err != nil {
+		return err
+	}
+	rendered, err := utilities.RenderText(string(content), a.templateData(sc), fileFuncs)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Src, err)
+	}
+	c.Src, err = sc.Workspace.WriteFile("template-*-"+filepath.Base(c.Dest), []byte(rendered))
+	return err
+}
+
+type host struct {
+	Name, Address string
+	Port          int
+	Vars          map[string]string
+}
+
+// hostGroup declares an inventory group, so the plugins can generate the
+// inventory instead of reading -inventory.
+type hostGroup struct {
+	Group, User string
+	Vars        map[string]string
+	Hosts       []*host
+}
+
 type cred struct {
 	DbName, Username, Password string
 }
 
+// network declares a docker network with the apps that join it, each with
+// the aliases it is reachable by. An app without aliases is reachable by
+// its own name.
+type network struct {
+	Name, Driver string
+	Apps         map[string][]string
+}
+
+// configureNetworks gives every app its networks. It runs before the apps
+// are configured, while their names are still the ones networks refer to.
+func (sc *Scenario) configureNetworks() error {
+	for _, n := range sc.Networks {
+		if !plugins.NetworkName.MatchString(n.Name) {
+			return fmt.Errorf("%s name %q", utilities.INVALID_NETWORK, n.Name)
+		}
+		joined := map[string]bool{}
+		for _, a := range sc.Apps {
+			aliases, ok := n.Apps[a.Name]
+			if !ok {
+				continue
+			}
+			joined[a.Name] = true
+			if len(aliases) == 0 {
+				aliases = []string{a.Name}
+			}
+			for _, alias := range aliases {
+				if !plugins.NetworkName.MatchString(alias) {
+					return fmt.Errorf("%s %s: alias %q of %s", utilities.INVALID_NETWORK, n.Name, alias, a.Name)
+				}
+			}
+			a.Networks = append(a.Networks, &plugins.Network{Name: n.Name, Driver: n.Driver, Aliases: aliases})
+			a.Aliases = append(a.Aliases, aliases...)
+		}
+		for name := range n.Apps {
+			if !joined[name] {
+				return fmt.Errorf("%s %s: app %s is not found", utilities.INVALID_NETWORK, n.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
 type playbook struct {
 	Name, Play, State,
 	Inventory, User string
-	Containers []*plugins.Container
-	Apps       []string
+	Containers  []*plugins.Container
+	Apps        []string
+	Ansible     *plugins.AnsibleOptions
+	AnsibleArgs []string
 }
 
 func (p *playbook) baseDuplicate() *playbook {
@@ -71,6 +200,8 @@ func (p *playbook) baseDuplicate() *playbook {
 	dup.Inventory = p.Inventory
 	dup.User = p.User
 	dup.State = p.State
+	dup.Ansible = p.Ansible
+	dup.AnsibleArgs = p.AnsibleArgs
 	dupContainers := make([]*plugins.Container, len(p.Containers))
 	for i, _ := range p.Containers {
 		dupContainers[i] = p.Containers[i].BaseDuplicate()
@@ -100,14 +231,33 @@ func (p *playbook) toAction(a *plugins.Action) {
 	a.Play = p.Play
 	a.Inventory = p.Inventory
 	a.Containers = p.Containers
+	a.Ansible = p.Ansible.Merge(&plugins.AnsibleOptions{Args: p.AnsibleArgs})
 }
 
 type Scenario struct {
 	Env, Id, Description,
 	Dest, Suffix string
 	Oses      []*os
+	Hosts     []*hostGroup
 	Apps      []*app
 	Playbooks []*playbook
+	// Registry logs in the hosts pulling images from its server, unless
+	// the app declares its own
+	Registry *plugins.Registry
+	Networks []*network
+	// Workspace receives the files downloaded or rendered while parsing
+	Workspace *utilities.Workspace `json:"-"`
+	// BaseDir is where relative customization srcs are found
+	BaseDir string `json:"-"`
+	// Lock pins the app images and repository refs; Locked refuses a
+	// missing or stale lock
+	Lock     *Lock `json:"-"`
+	Locked   bool  `json:"-"`
+	unlocked []string
+	pinned   map[string]bool
+	// InventoryFile is where `addr` finds the hosts of an app when the
+	// scenario declares none
+	InventoryFile string `json:"-"`
 }
 
 func (sc *Scenario) Configure(config []byte) error {
@@ -125,38 +275,66 @@ func (sc *Scenario) Configure(config []byte) error {
 }
 
 func (sc *Scenario) Parse(plugin *plugins.Plugin) ([]*plugins.Action, error) {
+	if sc.Registry != nil {
+		if err := sc.Registry.Configure(); err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.configureNetworks(); err != nil {
+		return nil, err
+	}
 	for i, _ := range sc.Apps {
 		if err := sc.Apps[i].configure(sc); err != nil {
 			return nil, err
 		}
 	}
+	if err := sc.checkLock(); err != nil {
+		return nil, err
+	}
+	// templates see every app configured, so they can refer to each other
+	for _, a := range sc.Apps {
+		if a.Build != nil {
+			tag, err := utilities.ExecuteTemplate(a.Build.Tag, a.templateData(sc), "", fileFuncs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", a.Name, err)
+			}
+			a.Build.Tag, a.Image = tag, tag
+		}
+		if a.Registry == nil && sc.Registry != nil && a.Image != "" && sc.Registry.Serves(a.Image) {
+			a.Registry = sc.Registry
+		}
+		for _, c := range a.Customizations {
+			if c.Template {
+				if err := a.render(sc, c); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
 	actions, counter := make([]*plugins.Action, sc.countContainers()), 0
+	inv, err := sc.inventory()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, p := range sc.Playbooks {
 		action := &plugins.Action{}
 		action.Suffix = sc.Suffix
-		os := &os{}
-		if len(sc.Oses) == 0 {
-			return nil, errors.New(utilities.UNKOWN_OSES)
-		} else if len(sc.Oses) == 1 {
-			os = sc.Oses[0]
-		} else {
-			for _, k := range sc.Oses {
-				if k.User == p.User {
-					os = k
-					break
-				}
-			}
-			if os.User == "" {
-				return nil, errors.New(utilities.UNKOWN_OSES)
-			}
+		action.Workspace = sc.Workspace
+		os, err := sc.findOs(p.User)
+		if err != nil {
+			return nil, err
 		}
 		action.User = os.User
 		action.PythonInterpreter = os.PythonInterpreter
+		action.Hosts = inv
 
 		if err := p.configure(plugin); err != nil {
 			return nil, err
 		}
+		if inv != nil && !inv.HasGroup(p.Inventory) {
+			return nil, fmt.Errorf("%s %s (known groups: %v)", utilities.UNDEFINED_INVENTORY_GROUP, p.Inventory, inv.Groups())
+		}
 
 		if len(p.Apps) != 0 {
 			for _, appString := range p.Apps {
@@ -167,35 +345,138 @@ func (sc *Scenario) Parse(plugin *plugins.Plugin) ([]*plugins.Action, error) {
 				if err != nil {
 					return nil, err
 				}
-				sc.configureContainers(subPlaybook, plugin, appString)
+				if err := sc.configureContainers(subPlaybook, plugin, appString); err != nil {
+					return nil, err
+				}
+				for _, c := range subPlaybook.Containers {
+					if err := c.Attach(app.Networks); err != nil {
+						return nil, err
+					}
+					if err := c.Mount(app.Volumes); err != nil {
+						return nil, err
+					}
+				}
 				app.toAction(subAction)
 				subPlaybook.toAction(subAction)
 				actions[counter] = subAction
 				counter++
 			}
 		} else {
-			sc.configureContainers(p, plugin, "")
+			if err := sc.configureContainers(p, plugin, ""); err != nil {
+				return nil, err
+			}
 			p.toAction(action)
 			actions[counter] = action
 			counter++
 		}
 	}
+	if f, ok := (*plugin).(plugins.Failer); ok {
+		if err := f.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.resolveAddrs(actions, inv); err != nil {
+		return nil, err
+	}
 	return actions, nil
 }
 
-func (sc *Scenario) configureContainers(p *playbook, plugin *plugins.Plugin, appString string) {
+// fileFuncs are the functions templated customizations can use besides the
+// scenario fields. `env` reads an environment variable of this machine.
+var fileFuncs = map[string]interface{}{
+	"env": gos.Getenv,
+}
+
+// templateFuncs are the functions container params can use. `host`
+// references a fact of the host the container runs on and `addr` the
+// address and port another app is reachable at.
+func (sc *Scenario) templateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"env":  gos.Getenv,
+		"host": plugins.HostFact,
+		"addr": sc.addr,
+	}
+}
+
+func (sc *Scenario) configureContainers(p *playbook, plugin *plugins.Plugin, appString string) error {
 	for i, _ := range p.Containers {
 		p.Containers[i].Name = p.Name
 		if p.Containers[i].State == "" {
 			p.Containers[i].State = p.State
 		}
 		masked := (*plugin).Mask(p.Containers[i].Params)
-		parsed := utilities.ParseTemplate(masked, sc, appString)
+		parsed, err := utilities.ExecuteTemplate(masked, sc, appString, sc.templateFuncs())
+		if err != nil {
+			return fmt.Errorf("%s: %s", p.Name, err)
+		}
 		unmask := (*plugin).Unmask(parsed)
 		p.Containers[i].Params = utilities.ParseEnvFlags(unmask)
 		p.Containers[i].Configure()
 	}
+	return nil
+}
+func (sc *Scenario) findOs(user string) (*os, error) {
+	if len(sc.Oses) == 0 {
+		return nil, errors.New(utilities.UNKOWN_OSES)
+	} else if len(sc.Oses) == 1 {
+		return sc.Oses[0], nil
+	}
+	for _, k := range sc.Oses {
+		if k.User == user {
+			return k, nil
+		}
+	}
+	return nil, errors.New(utilities.UNKOWN_OSES)
 }
+
+// inventory builds the inventory declared in hosts, or returns nil when
+// the scenario relies on -inventory.
+func (sc *Scenario) inventory() (*inventory.Inventory, error) {
+	if len(sc.Hosts) == 0 {
+		return nil, nil
+	}
+	inv := inventory.New()
+	for _, g := range sc.Hosts {
+		if g.Group == "" {
+			return nil, errors.New(utilities.INVALID_HOSTS)
+		}
+		os, err := sc.findOs(g.User)
+		if err != nil {
+			return nil, err
+		}
+		inv.AddGroup(g.Group)
+		for k, v := range g.Vars {
+			inv.SetGroupVar(g.Group, k, v)
+		}
+		for _, h := range g.Hosts {
+			if h.Name == "" {
+				h.Name = h.Address
+			}
+			if h.Name == "" {
+				return nil, errors.New(utilities.INVALID_HOSTS)
+			}
+			vars := map[string]string{}
+			if os.User != "" {
+				vars["ansible_user"] = os.User
+			}
+			if os.PythonInterpreter != "" {
+				vars["ansible_python_interpreter"] = os.PythonInterpreter
+			}
+			if h.Address != "" {
+				vars["ansible_host"] = h.Address
+			}
+			if h.Port != 0 {
+				vars["ansible_port"] = strconv.Itoa(h.Port)
+			}
+			for k, v := range h.Vars {
+				vars[k] = v
+			}
+			inv.AddHost(g.Group, h.Name, vars)
+		}
+	}
+	return inv, nil
+}
+
 func (sc *Scenario) findApp(name string) (*app, error) {
 	if name != "" {
 		for k, v := range sc.Apps {
@@ -1,7 +1,12 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	gos "os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aminjam/hipops/plugins"
@@ -105,7 +110,7 @@ func TestScenarioParse_UnhappyPath(t *testing.T) {
     "type": "db",
     "image": "aminjam/mongodb:latest",
     "repository":{
-      "sshUrl": "git@github.com:aminjam/beersample-node.git"
+      "url": "ftp://github.com/aminjam/beersample-node.git"
     },
     "ports": [27017]
   }]
@@ -114,7 +119,7 @@ func TestScenarioParse_UnhappyPath(t *testing.T) {
 	var sc3 Scenario
 	err = sc3.Configure(config)
 	_, err = sc3.Parse(&testPlugin)
-	spec.Expect(err.Error()).ToEqual(utilities.INVALID_REPOSITORY)
+	spec.Expect(err.Error()).ToEqual(utilities.INVALID_REPOSITORY + " ftp://github.com/aminjam/beersample-node.git is not an https://, ssh:// or user@host:path URL")
 
 	const playbooks_inventory_missing = `
   ,"playbooks": [{
@@ -143,3 +148,391 @@ func TestScenarioParse_UnhappyPath(t *testing.T) {
 	_, err = sc5.Parse(&testPlugin)
 	spec.Expect(err.Error()).ToEqual(utilities.UNKNOWN_CONTAINERS)
 }
+
+func TestScenarioParse_AnsibleOptions(t *testing.T) {
+	const playbooks_ansible = `
+  ,"playbooks": [{
+    "inventory": "tag_App-Role_SAMOMY-DEV",
+    "apps": ["{{index .Apps 0}}"],
+    "ansible": {"limit": "web1", "forks": 5, "become": true},
+    "ansibleArgs": ["--start-at-task", "run the containers"],
+    "containers": [{
+      "params": "-d {{.App.Image}}"
+    }]
+  }]
+`
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps, playbooks_ansible))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+
+	spec := utilities.Spec(t)
+	spec.Expect(err).ToEqual(nil)
+	options := actions[0].Ansible.Merge(&plugins.AnsibleOptions{Limit: "web2", Check: true, Args: []string{"-e", "x=1"}})
+	spec.Expect(strings.Join(options.Params(), " ")).ToEqual("--limit web2 --forks 5 --check --become --start-at-task run the containers -e x=1")
+}
+
+func TestScenarioParse_Hosts(t *testing.T) {
+	const hosts = `
+  ,"hosts": [{
+    "group": "tag_App-Role_SAMOMY-DEV",
+    "vars": {"env": "dev"},
+    "hosts": [{"address": "10.0.0.2", "port": 2222}, {"name": "box", "address": "10.0.0.3", "vars": {"role": "db"}}]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s%s}", scenario, oses, hosts, apps, playbooks))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+
+	inv := new(strings.Builder)
+	actions[0].Hosts.WriteINI(inv)
+	spec.Expect(inv.String()).ToEqual(`[tag_App-Role_SAMOMY-DEV]
+10.0.0.2 ansible_host=10.0.0.2 ansible_port=2222 ansible_python_interpreter="PATH=/home/core/bin:$PATH python" ansible_user=core
+box ansible_host=10.0.0.3 ansible_python_interpreter="PATH=/home/core/bin:$PATH python" ansible_user=core role=db
+
+[tag_App-Role_SAMOMY-DEV:vars]
+env=dev
+
+`)
+
+	const undefined_group = `
+  ,"hosts": [{"group": "tag_App-Role_DEMO", "hosts": [{"address": "10.0.0.2"}]}]
+`
+	config = []byte(fmt.Sprintf("{%s%s%s%s%s}", scenario, oses, undefined_group, apps, playbooks))
+	var sc1 Scenario
+	sc1.Configure(config)
+	_, err = sc1.Parse(&testPlugin)
+	spec.Expect(err.Error()).ToEqual(utilities.UNDEFINED_INVENTORY_GROUP + " tag_App-Role_SAMOMY-DEV (known groups: [tag_App-Role_DEMO])")
+}
+
+func TestScenarioParse_HostFacts(t *testing.T) {
+	const playbooks_facts = `
+  ,"playbooks": [{
+    "inventory": "tag_App-Role_SAMOMY-DEV",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{
+      "params": "-e ADVERTISE={{ host \"ip\" }}:{{index .App.Ports 0}} -h {{host \"hostname\"}} -d {{.App.Image}}"
+    }]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps, playbooks_facts))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+	params := actions[0].Containers[0].Params
+	spec.Expect(params).ToEqual("--name 0-db-mongo -e ADVERTISE=@HOST(ip):27017 -h @HOST(hostname) -d aminjam/mongodb:latest")
+
+	resolved := plugins.ResolveFacts(params, func(f *plugins.Fact) string { return "<" + f.Jinja + ">" })
+	spec.Expect(resolved).ToEqual("--name 0-db-mongo -e ADVERTISE=<ansible_default_ipv4.address>:27017 -h <ansible_hostname> -d aminjam/mongodb:latest")
+
+	config = []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps, strings.Replace(playbooks_facts, `\"ip\"`, `\"mac\"`, 1)))
+	var sc1 Scenario
+	sc1.Configure(config)
+	_, err = sc1.Parse(&testPlugin)
+	spec.ExpectString(err.Error()).ToContain(`unknown host fact "mac" (known facts: hostname, fqdn, ip, os, arch, cpus, memory)`)
+}
+
+func TestScenarioParse_TemplatedCustomizations(t *testing.T) {
+	const apps_templated = `
+  ,"apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017]
+  }, {
+    "name": "backend-api",
+    "type": "nodejs",
+    "image": "aminjam/nodejs:latest",
+    "ports": [8080],
+    "customizations": [
+      {"src": "app.env", "dest": ".env", "template": true},
+      {"src": "nginx.conf", "dest": "conf/nginx.conf"}
+    ]
+  }]
+`
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-parser")
+	defer gos.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("PORT={{index .App.Ports 0}}\nMONGO_URL=mongodb://{{(index .Apps 0).Name}}:{{index (index .Apps 0).Ports 0}}/{{.Env}}\nQUERY={{ \"a=1&b<2 'c'\" }}\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("listen {{ .port }};"), 0600)
+
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_templated, playbooks))
+	var sc Scenario
+	sc.Configure(config)
+	ws, _ := utilities.NewWorkspace("", false)
+	defer ws.Remove()
+	sc.Workspace, sc.BaseDir = ws, dir
+	_, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+
+	files := sc.Apps[1].Customizations
+	spec.Expect(filepath.Dir(files[0].Src), files[1].Src).ToEqual(ws.Dir, filepath.Join(dir, "nginx.conf"))
+	rendered, _ := ioutil.ReadFile(files[0].Src)
+	spec.Expect(string(rendered)).ToEqual("PORT=8080\nMONGO_URL=mongodb://0-db-mongo:27017/test\nQUERY=a=1&b<2 'c'\n")
+
+	ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("IP={{ host \"ip\" }}"), 0600)
+	var sc1 Scenario
+	sc1.Configure(config)
+	sc1.Workspace, sc1.BaseDir = ws, dir
+	_, err = sc1.Parse(&testPlugin)
+	spec.ExpectString(err.Error()).ToContain(`function "host" not defined`)
+}
+
+func TestScenarioParse_DirectoryCustomizations(t *testing.T) {
+	const apps_files = `
+  ,"apps": [{
+    "name": "nginx",
+    "image": "nginx:latest",
+    "ports": [80],
+    "customizations": [
+      {"src": "conf", "dest": "conf", "mode": "0640", "owner": "www-data", "group": "adm", "exclude": ["*.bak", "secrets"]},
+      {"src": "certs/*.pem", "dest": "certs", "mode": 600},
+      {"src": "nginx.conf", "dest": "nginx.conf"}
+    ]
+  }]
+`
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-parser")
+	defer gos.RemoveAll(dir)
+	for _, f := range []string{"conf/nginx.conf", "conf/nginx.conf.bak", "conf/sites/api.conf", "conf/secrets/key", "certs/api.pem", "certs/README", "nginx.conf"} {
+		gos.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0700)
+		ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0600)
+	}
+
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_files, playbooks))
+	var sc Scenario
+	sc.Configure(config)
+	sc.BaseDir = dir
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+
+	files := actions[0].Files
+	dests := []string{}
+	for _, f := range files {
+		dests = append(dests, fmt.Sprintf("%s %s %s", strings.TrimPrefix(f.Dest, "/data/0-test/generic/nginx/"), f.Mode, f.Chown()))
+	}
+	spec.Expect(strings.Join(dests, ", ")).ToEqual("conf/nginx.conf 0640 www-data:adm, conf/sites/api.conf 0640 www-data:adm, certs/api.pem 0600 , nginx.conf 0400 ")
+	spec.Expect(files[1].Src, files[1].DestFolder).ToEqual(filepath.Join(dir, "conf/sites/api.conf"), "/data/0-test/generic/nginx/conf/sites")
+
+	config = []byte(strings.Replace(string(config), `"mode": 600`, `"mode": "rw"`, 1))
+	var sc1 Scenario
+	spec.ExpectString(sc1.Configure(config).Error()).ToContain(utilities.INVALID_FILE_MODE)
+}
+
+func TestScenarioParse_Repository(t *testing.T) {
+	spec := utilities.Spec(t)
+	for _, r := range []struct {
+		repository, url, ref, err string
+	}{
+		{`"sshUrl": "github.com/aminjam/backend.git"`, "ssh://git@github.com/aminjam/backend.git", "master", ""},
+		{`"sshUrl": "git@github.com:aminjam/backend.git", "branch": "dev"`, "git@github.com:aminjam/backend.git", "dev", ""},
+		{`"url": "https://github.com/aminjam/backend.git", "ref": "v1.2.0", "depth": 1`, "https://github.com/aminjam/backend.git", "v1.2.0", ""},
+		{`"url": "ssh://git@example.com:2222/backend.git", "ref": "3f2a9c1"`, "ssh://git@example.com:2222/backend.git", "3f2a9c1", ""},
+		{`"url": "http://github.com/aminjam/backend.git"`, "", "", "is not encrypted, use https://"},
+		{`"url": "https://github.com/aminjam/backend.git", "ref": "--upload-pack=touch"`, "", "", `ref "--upload-pack=touch" is not a valid branch, tag or commit`},
+		{`"url": "https://github.com/aminjam/backend.git", "deployKey": "~/.ssh/deploy"`, "", "", "deployKey needs an SSH URL"},
+		{`"branch": "dev"`, "", "", "url or sshUrl is required"},
+		{`"url": "https://github.com/aminjam/backend.git", "mode": "ship", "build": "make"`, "https://github.com/aminjam/backend.git", "master", ""},
+		{`"url": "https://github.com/aminjam/backend.git", "build": "make"`, "", "", `build needs mode "ship"`},
+		{`"url": "https://github.com/aminjam/backend.git", "mode": "rsync"`, "", "", `mode "rsync" is not "clone" or "ship"`},
+	} {
+		var repository plugins.Repository
+		json.Unmarshal([]byte("{"+r.repository+"}"), &repository)
+		err := repository.Configure()
+		if r.err != "" {
+			spec.ExpectString(err.Error()).ToContain(r.err)
+			continue
+		}
+		spec.Expect(err, repository.CloneUrl(), repository.Ref).ToEqual(nil, r.url, r.ref)
+	}
+
+	r := &plugins.Repository{Url: "git@github.com:aminjam/backend.git", DeployKey: "~/.ssh/deploy", Ref: "0123abc", Depth: 1, Submodules: true}
+	spec.Expect(r.Configure(), r.SshKey, r.IsCommit()).ToEqual(nil, "~/.ssh/deploy", true)
+}
+
+func TestScenarioParse_Registry(t *testing.T) {
+	const apps_private = `
+  ,"registry": {"server": "registry.example.com", "username": "deploy", "passwordEnv": "HIPOPS_TEST_REGISTRY"}
+  ,"apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017]
+  }, {
+    "name": "api",
+    "image": "registry.example.com/team/api:v1",
+    "ports": [8080]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_private, playbooks))
+	var sc Scenario
+	sc.Configure(config)
+	_, err := sc.Parse(&testPlugin)
+	spec.Expect(err, sc.Apps[0].Registry, sc.Apps[1].Registry).ToEqual(nil, (*plugins.Registry)(nil), sc.Registry)
+	spec.Expect(string(sc.Registry.Password)).ToEqual("")
+	spec.ExpectString(sc.Registry.Resolve().Error()).ToContain("invalid registry: registry.example.com: $HIPOPS_TEST_REGISTRY is not set")
+
+	gos.Setenv("HIPOPS_TEST_REGISTRY", "s3cret")
+	defer gos.Unsetenv("HIPOPS_TEST_REGISTRY")
+	var sc1 Scenario
+	sc1.Configure(config)
+	_, err = sc1.Parse(&testPlugin)
+	spec.Expect(err, sc1.Registry.Resolve()).ToEqual(nil, nil)
+	spec.Expect(string(sc1.Registry.Password)).ToEqual("s3cret")
+	spec.Expect(strings.Contains(fmt.Sprintf("%+v %#v", sc1.Registry, sc1.Registry), "s3cret")).ToEqual(false)
+
+	literal := &plugins.Registry{Server: "registry.example.com", Username: "deploy", Password: "s3cret"}
+	spec.ExpectString(literal.Configure().Error()).ToContain("password must come from passwordEnv or passwordFile")
+}
+
+func TestScenarioParse_Networks(t *testing.T) {
+	const apps_networked = `
+  ,"networks": [
+    {"name": "backend", "apps": {"mongo": ["db", "mongo"], "backend-api": []}},
+    {"name": "frontend", "driver": "overlay", "apps": {"backend-api": ["api"]}}
+  ]
+  ,"apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017]
+  }, {
+    "name": "backend-api",
+    "type": "nodejs",
+    "image": "aminjam/nodejs:latest",
+    "ports": [8080]
+  }]
+`
+	const playbooks_networked = `
+  ,"playbooks": [{
+    "inventory": "tag_App-Role_SAMOMY-DEV",
+    "apps": ["{{index .Apps 0}}", "{{index .Apps 1}}"],
+    "containers": [{
+      "params": "-e MONGO_HOST={{index (index .Apps 0).Aliases 0}} -d {{.App.Image}}"
+    }]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_networked, playbooks_networked))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+
+	mongo, api := actions[0].Containers[0], actions[1].Containers[0]
+	spec.Expect(mongo.Params, len(mongo.Connect)).ToEqual("--network backend --network-alias db --network-alias mongo --name 0-db-mongo -e MONGO_HOST=db -d aminjam/mongodb:latest", 0)
+	spec.Expect(api.Params).ToEqual("--network backend --network-alias backend-api --name 0-nodejs-backend-api -e MONGO_HOST=db -d aminjam/nodejs:latest")
+	spec.Expect(len(api.Connect), api.Connect[0].Name, api.Connect[0].Driver, api.Connect[0].Aliases[0]).ToEqual(1, "frontend", "overlay", "api")
+	spec.Expect(len(actions[1].Networks)).ToEqual(2)
+
+	for _, n := range []struct{ networks, err string }{
+		{`{"name": "backend", "apps": {"redis": []}}`, "invalid network: backend: app redis is not found"},
+		{`{"name": "back end", "apps": {"mongo": []}}`, `invalid network: name "back end"`},
+		{`{"name": "backend", "apps": {"mongo": ["-db"]}}`, `invalid network: backend: alias "-db" of mongo`},
+	} {
+		config := []byte(fmt.Sprintf(`{%s%s,"networks": [%s]%s%s}`, scenario, oses, n.networks, apps, playbooks))
+		var sc Scenario
+		sc.Configure(config)
+		_, err := sc.Parse(&testPlugin)
+		spec.ExpectString(err.Error()).ToContain(n.err)
+	}
+}
+
+func TestScenarioParse_Addr(t *testing.T) {
+	const hosts_split = `
+  ,"hosts": [
+    {"group": "db", "hosts": [{"name": "mongo-1", "address": "10.0.0.5"}, {"address": "10.0.0.6"}]},
+    {"group": "web", "hosts": [{"address": "10.0.0.2"}]}
+  ]
+  ,"apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017]
+  }, {
+    "name": "backend-api",
+    "type": "nodejs",
+    "image": "aminjam/nodejs:latest"
+  }, {
+    "name": "cache",
+    "host": "redis.internal"
+  }]
+`
+	const playbooks_split = `
+  ,"playbooks": [{
+    "inventory": "db",
+    "apps": ["{{index .Apps 0}}"],
+    "containers": [{"params": "-p 9990:{{index .App.Ports 0}} -d {{.App.Image}}"}]
+  }, {
+    "inventory": "web",
+    "apps": ["{{index .Apps 1}}"],
+    "containers": [{"params": "-e MONGO={{ addr \"mongo\" 27017 }} -e REDIS={{addr \"cache\" 6379}} -d {{.App.Image}}"}]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, hosts_split, playbooks_split))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+	spec.Expect(actions[1].Containers[0].Params).ToEqual("--name 0-nodejs-backend-api -e MONGO=10.0.0.5:9990 -e REDIS=redis.internal:6379 -d aminjam/nodejs:latest")
+
+	for _, c := range []struct{ old, new, err string }{
+		{`\"mongo\" 27017`, `\"redis\" 6379`, "unresolved addr: app redis is not found"},
+		{`\"mongo\" 27017`, `\"mongo\" 28017`, "unresolved addr: 0-nodejs-backend-api: mongo does not publish port 28017"},
+		{`-p 9990:`, `-p 127.0.0.1:9990:`, "unresolved addr: 0-nodejs-backend-api: mongo does not publish port 27017"},
+		{`"host": "redis.internal"`, `"image": "redis"`, "unresolved addr: 0-nodejs-backend-api: cache is not deployed by any playbook and has no host"},
+	} {
+		config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, strings.Replace(hosts_split, c.old, c.new, 1), strings.Replace(playbooks_split, c.old, c.new, 1)))
+		var sc Scenario
+		sc.Configure(config)
+		_, err := sc.Parse(&testPlugin)
+		spec.ExpectString(err.Error()).ToContain(c.err)
+	}
+}
+
+func TestScenarioParse_Volumes(t *testing.T) {
+	const apps_volumes = `
+  ,"apps": [{
+    "name": "mongo",
+    "type": "db",
+    "image": "aminjam/mongodb:latest",
+    "ports": [27017],
+    "volumes": [
+      {"name": "data", "path": "db", "target": "/data/db", "backupBeforeDeploy": true},
+      {"name": "mongo-logs", "target": "/var/log/mongodb"}
+    ]
+  }]
+`
+	spec := utilities.Spec(t)
+	config := []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_volumes, playbooks))
+	var sc Scenario
+	sc.Configure(config)
+	actions, err := sc.Parse(&testPlugin)
+	spec.Expect(err).ToEqual(nil)
+
+	c := actions[0].Containers[0]
+	spec.ExpectString(c.Params).ToContain("-v /data/0-test/db/0-db-mongo/db:/data/db -v 0-db-mongo_mongo-logs:/var/log/mongodb --name 0-db-mongo")
+	spec.Expect(len(c.Backup), c.Backup[0].SnapshotDir, len(actions[0].Volumes)).ToEqual(1, "/data/snapshots/0-db-mongo", 2)
+
+	const apps_relative = `
+  ,"apps": [{"name": "mongo", "image": "aminjam/mongodb:latest", "ports": [27017], "volumes": [{"name": "data", "target": "data/db"}]}]
+`
+	config = []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, apps_relative, playbooks))
+	var sc1 Scenario
+	sc1.Configure(config)
+	_, err = sc1.Parse(&testPlugin)
+	spec.ExpectString(err.Error()).ToContain(`invalid volume: data: target "data/db" is not an absolute path`)
+
+	config = []byte(fmt.Sprintf("{%s%s%s%s}", scenario, oses, strings.Replace(apps_relative, `"data"`, `"d"`, 1), playbooks))
+	var sc2 Scenario
+	sc2.Configure(config)
+	_, err = sc2.Parse(&testPlugin)
+	spec.ExpectString(err.Error()).ToContain(`invalid volume: name "d"`)
+}
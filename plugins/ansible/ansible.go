@@ -1,18 +1,29 @@
 package ansible
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/plugins/shell"
 	"github.com/aminjam/hipops/utilities"
 )
 
 var Instance plugins.Plugin
 
-type instance struct{}
+type instance struct {
+	// playbookPath is where the built-in playbook is unpacked; embedded
+	// unpacks it into the run's workspace on the first Run.
+	playbookPath string
+	embedded     bool
+}
 
 func init() {
 	Instance = &instance{}
@@ -29,21 +40,37 @@ func (i *instance) Unmask(input string) string {
 	return p.ReplaceAllString(input, "{{ ansible_${2}")
 }
 func (i *instance) Run(a *plugins.Action) error {
-	content, err := json.Marshal(a)
+	if err := i.unpack(a.Workspace); err != nil {
+		return err
+	}
+	if i.playbookPath != "" && !filepath.IsAbs(a.Play) {
+		a.Play = filepath.Join(i.playbookPath, a.Play)
+	}
+	// facts are left for Ansible to render from what it gathers on each host
+	extraVars := *a
+	extraVars.Containers = plugins.ResolveContainers(a.Containers, func(f *plugins.Fact) string {
+		return fmt.Sprintf("{{ %s }}", f.Jinja)
+	})
+	content, err := json.Marshal(&extraVars)
 	if err != nil {
 		return err
 	}
-	fileName, err := utilities.WriteFile(content, "json", a.Suffix)
+	fileName, err := a.Workspace.WriteFile("extra-vars-*.json", content)
+	if err != nil {
+		return err
+	}
+	inventoryFile, err := writeInventory(a)
 	if err != nil {
 		return err
 	}
 	params := []string{
 		a.Play,
-		"-i", a.InventoryFile,
+		"-i", inventoryFile,
 		"-u", a.User,
 		"--private-key", a.PrivateKey,
 		"--extra-vars", "@" + fileName,
 	}
+	params = append(params, a.Ansible.Params()...)
 	switch a.Debug {
 	case 1:
 		params = append(params, "-v")
@@ -52,7 +79,101 @@ func (i *instance) Run(a *plugins.Action) error {
 	case 3:
 		params = append(params, "-vvv")
 	}
-	return utilities.RunCmd("ansible-playbook", params...)
+	env, resultFile, err := resultEnv(a.Workspace)
+	if err != nil {
+		return err
+	}
+	// the output streams as ansible-playbook prints it, and the results
+	// come from the callback's file
+	err = utilities.RunCmdOutput(os.Stdout, env, "ansible-playbook", params...)
+	output, _ := ioutil.ReadFile(resultFile)
+	result, parseErr := parseResult(output)
+	if parseErr != nil {
+		// a run that wrote no results only loses the summary
+		fmt.Fprintf(os.Stderr, "warning: %s\n", parseErr)
+		return err
+	}
+	a.Result = result
+	if failed := result.Failed(); err != nil && len(failed) != 0 {
+		return fmt.Errorf("ansible-playbook failed on %s", strings.Join(failed, ", "))
+	}
+	return err
+}
+
+// resultEnv makes ansible-playbook load the result callback from the
+// workspace, next to any callback plugins of the environment, and returns
+// the file it writes the results to.
+func resultEnv(ws *utilities.Workspace) ([]string, string, error) {
+	dir := ws.Path("callback_plugins")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "hipops_result.py"), resultCallback, 0644); err != nil {
+		return nil, "", err
+	}
+	resultFile, err := ws.WriteFile("result-*.json", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	plugins := dir
+	if existing := os.Getenv("ANSIBLE_CALLBACK_PLUGINS"); existing != "" {
+		plugins += string(os.PathListSeparator) + existing
+	}
+	return []string{"ANSIBLE_CALLBACK_PLUGINS=" + plugins, "HIPOPS_RESULT_FILE=" + resultFile}, resultFile, nil
+}
+
+// writeInventory returns -inventory, or the scenario's hosts written into
+// the workspace.
+func writeInventory(a *plugins.Action) (string, error) {
+	if a.Hosts == nil {
+		return a.InventoryFile, nil
+	}
+	hosts := new(bytes.Buffer)
+	if err := a.Hosts.WriteINI(hosts); err != nil {
+		return "", err
+	}
+	return a.Workspace.WriteFile("inventory-*.ini", hosts.Bytes())
+}
+
+// RestoreVolume runs the restore as an ad-hoc shell command on the hosts
+// of the action's group.
+func (i *instance) RestoreVolume(a *plugins.Action, v *plugins.Volume, snapshot string) error {
+	inventoryFile, err := writeInventory(a)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(a.Containers))
+	for k, c := range a.Containers {
+		names[k] = c.Name
+	}
+	params := []string{
+		a.Inventory,
+		"-i", inventoryFile,
+		"-u", a.User,
+		"--private-key", a.PrivateKey,
+		"-m", "shell",
+		"-a", shell.Restore(v, snapshot, names),
+	}
+	if a.Ansible != nil && a.Ansible.Become {
+		params = append(params, "--become")
+	}
+	return utilities.RunCmd("ansible", params...)
+}
+
+// unpack writes the built-in playbook into the workspace once per run.
+func (i *instance) unpack(ws *utilities.Workspace) error {
+	if !i.embedded || i.playbookPath != "" {
+		return nil
+	}
+	if ws == nil {
+		return errors.New(utilities.NO_WORKSPACE)
+	}
+	dir := ws.Path("playbook")
+	if err := Unpack(dir, false); err != nil {
+		return err
+	}
+	i.playbookPath = dir
+	return nil
 }
 func (i *instance) ValidateParams(args ...string) error {
 	var inventoryFile = args[0]
@@ -60,8 +181,10 @@ func (i *instance) ValidateParams(args ...string) error {
 	if _, err := filepath.Abs(inventoryFile); err != nil {
 		return err
 	}
-	if playbookPath == "" {
-		return errors.New("--playbook-path is required for ansible plugin")
+	i.embedded = playbookPath == ""
+	i.playbookPath = ""
+	if i.embedded {
+		return nil
 	}
 	if _, err := filepath.Abs(playbookPath); err != nil {
 		return err
@@ -1,6 +1,9 @@
 package ansible
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -31,3 +34,93 @@ func TestAnsiblePlugin_masking(t *testing.T) {
 		spec.ExpectString(val).ToContain(strings.Replace(entry.org, "box", "ansible", -1))
 	}
 }
+
+func TestAnsiblePlugin_defaultPlaybook(t *testing.T) {
+	spec := utilities.Spec(t)
+	i := &instance{}
+	spec.Expect(i.ValidateParams("./hosts/local", "")).ToEqual(nil)
+	spec.Expect(i.unpack(nil).Error()).ToEqual(utilities.NO_WORKSPACE)
+	ws, err := utilities.NewWorkspace("", false)
+	spec.Expect(err).ToEqual(nil)
+	defer ws.Remove()
+	spec.Expect(i.unpack(ws), i.playbookPath).ToEqual(nil, ws.Path("playbook"))
+
+	for _, f := range []string{"hipops.yml", "roles/containers/tasks/main.yml", "roles/files/tasks/main.yml"} {
+		_, err := os.Stat(filepath.Join(i.playbookPath, f))
+		spec.Expect(err).ToEqual(nil)
+	}
+	spec.ExpectString(Unpack(i.playbookPath, false).Error()).ToContain("already exists")
+	spec.Expect(Unpack(i.playbookPath, true)).ToEqual(nil)
+}
+
+const jsonCallbackOutput = `{
+  "plays": [{
+    "play": {"name": "tag_App-Role_DEMO"},
+    "tasks": [{
+      "task": {"name": "create the app dest"},
+      "hosts": {
+        "web1": {"changed": true},
+        "web2": {"changed": false},
+        "web3": {"unreachable": true, "msg": "Failed to connect to the host via ssh"}
+      }
+    }, {
+      "task": {"name": "run the containers"},
+      "hosts": {
+        "web1": {"changed": false},
+        "web2": {"failed": true, "msg": "non-zero return code"}
+      }
+    }]
+  }],
+  "stats": {
+    "web1": {"ok": 2, "changed": 1, "failures": 0, "unreachable": 0},
+    "web2": {"ok": 1, "changed": 0, "failures": 1, "unreachable": 0},
+    "web3": {"ok": 0, "changed": 0, "failures": 0, "unreachable": 1}
+  }
+}`
+
+func TestAnsiblePlugin_parseResult(t *testing.T) {
+	spec := utilities.Spec(t)
+	result, err := parseResult([]byte(jsonCallbackOutput))
+	spec.Expect(err, len(result.Hosts)).ToEqual(nil, 3)
+
+	web1, web2, web3 := result.Hosts[0], result.Hosts[1], result.Hosts[2]
+	spec.Expect(web1.Name, web1.Status, web1.Tasks[0].Status, web1.Tasks[1].Status).ToEqual("web1", plugins.STATUS_CHANGED, plugins.STATUS_CHANGED, plugins.STATUS_OK)
+	spec.Expect(web2.Status, web2.Tasks[1].Name, web2.Tasks[1].Msg).ToEqual(plugins.STATUS_FAILED, "run the containers", "non-zero return code")
+	spec.Expect(web3.Status, len(web3.Tasks)).ToEqual(plugins.STATUS_UNREACHABLE, 1)
+	spec.Expect(strings.Join(result.Failed(), ",")).ToEqual("web2,web3")
+
+	_, err = parseResult([]byte("PLAY [all] ****"))
+	spec.ExpectString(err.Error()).ToContain("unable to parse")
+}
+
+func TestAnsiblePlugin_RunUnparsedOutput(t *testing.T) {
+	spec := utilities.Spec(t)
+	bin, _ := ioutil.TempDir("", "hipops-ansible")
+	defer os.RemoveAll(bin)
+	results := filepath.Join(bin, "results.json")
+	ioutil.WriteFile(filepath.Join(bin, "ansible-playbook"), []byte("#!/bin/sh\n"+
+		"test -f \"${ANSIBLE_CALLBACK_PLUGINS%%:*}/hipops_result.py\" || exit 3\n"+
+		"echo 'PLAY [all] ****'\n"+
+		"[ -z \"$RESULTS\" ] || cp \"$RESULTS\" \"$HIPOPS_RESULT_FILE\"\n"+
+		"exit ${EXIT_CODE:-0}\n"), 0755)
+	ioutil.WriteFile(results, []byte(jsonCallbackOutput), 0600)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ws, _ := utilities.NewWorkspace("", false)
+	defer ws.Remove()
+
+	for _, debug := range []int{0, 1} {
+		a := &plugins.Action{Play: "hipops.yml", InventoryFile: "./hosts/local", Workspace: ws, Debug: debug}
+		spec.Expect((&instance{}).Run(a), a.Result == nil).ToEqual(nil, true)
+	}
+	os.Setenv("EXIT_CODE", "2")
+	defer os.Unsetenv("EXIT_CODE")
+	spec.ExpectString((&instance{}).Run(&plugins.Action{Play: "hipops.yml", Workspace: ws}).Error()).ToContain("exit status 2")
+
+	// the callback's results survive any stdout output
+	os.Setenv("RESULTS", results)
+	defer os.Unsetenv("RESULTS")
+	a := &plugins.Action{Play: "hipops.yml", Workspace: ws}
+	spec.ExpectString((&instance{}).Run(a).Error()).ToContain("ansible-playbook failed on web2, web3")
+	spec.Expect(len(a.Result.Hosts)).ToEqual(3)
+}
@@ -0,0 +1,58 @@
+# Records the results of a playbook run for hipops, in the layout of the
+# json stdout callback, into $HIPOPS_RESULT_FILE. It runs next to the stdout
+# callback, so ansible-playbook still prints its progress as usual.
+from __future__ import absolute_import, division, print_function
+__metaclass__ = type
+
+import json
+import os
+
+from ansible.plugins.callback import CallbackBase
+
+
+class CallbackModule(CallbackBase):
+    CALLBACK_VERSION = 2.0
+    CALLBACK_TYPE = 'aggregate'
+    CALLBACK_NAME = 'hipops_result'
+    CALLBACK_NEEDS_ENABLED = False
+    CALLBACK_NEEDS_WHITELIST = False
+
+    def __init__(self):
+        super(CallbackModule, self).__init__()
+        self.plays = []
+
+    def v2_playbook_on_play_start(self, play):
+        self.plays.append({'play': {'name': play.get_name()}, 'tasks': []})
+
+    def v2_playbook_on_task_start(self, task, is_conditional):
+        self.plays[-1]['tasks'].append({'task': {'name': task.get_name()}, 'hosts': {}})
+
+    def v2_playbook_on_handler_task_start(self, task):
+        self.v2_playbook_on_task_start(task, False)
+
+    def _record(self, result, **status):
+        if not self.plays or not self.plays[-1]['tasks']:
+            return
+        status['changed'] = result._result.get('changed', False)
+        status['msg'] = result._result.get('msg')
+        self.plays[-1]['tasks'][-1]['hosts'][result._host.get_name()] = status
+
+    def v2_runner_on_ok(self, result):
+        self._record(result)
+
+    def v2_runner_on_failed(self, result, ignore_errors=False):
+        self._record(result, failed=not ignore_errors)
+
+    def v2_runner_on_skipped(self, result):
+        self._record(result, skipped=True)
+
+    def v2_runner_on_unreachable(self, result):
+        self._record(result, unreachable=True)
+
+    def v2_playbook_on_stats(self, stats):
+        path = os.environ.get('HIPOPS_RESULT_FILE')
+        if not path:
+            return
+        summary = dict((host, stats.summarize(host)) for host in stats.processed)
+        with open(path, 'w') as f:
+            json.dump({'plays': self.plays, 'stats': summary}, f, default=str)
@@ -0,0 +1,47 @@
+package ansible
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// playbook is the default playbook and its roles, used when no
+// --playbook-path is given.
+//
+//go:embed playbook
+var playbook embed.FS
+
+// resultCallback records the results of every run, whatever the playbook.
+//
+//go:embed callback_plugins/hipops_result.py
+var resultCallback []byte
+
+// Unpack writes the default playbook to dir. Existing files are kept
+// unless overwrite is set.
+func Unpack(dir string, overwrite bool) error {
+	return fs.WalkDir(playbook, "playbook", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel("playbook", name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Stat(target); err == nil && !overwrite {
+			return fmt.Errorf("%s already exists", target)
+		}
+		content, err := playbook.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, content, 0644)
+	})
+}
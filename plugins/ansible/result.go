@@ -0,0 +1,91 @@
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aminjam/hipops/plugins"
+)
+
+// callbackOutput is what the result callback writes, in the layout of the
+// json stdout callback.
+type callbackOutput struct {
+	Plays []struct {
+		Tasks []struct {
+			Task struct {
+				Name string `json:"name"`
+			} `json:"task"`
+			Hosts map[string]struct {
+				Changed     bool        `json:"changed"`
+				Failed      bool        `json:"failed"`
+				Skipped     bool        `json:"skipped"`
+				Unreachable bool        `json:"unreachable"`
+				Msg         interface{} `json:"msg"`
+			} `json:"hosts"`
+		} `json:"tasks"`
+	} `json:"plays"`
+	Stats map[string]struct {
+		Changed     int `json:"changed"`
+		Failures    int `json:"failures"`
+		Unreachable int `json:"unreachable"`
+	} `json:"stats"`
+}
+
+func parseResult(content []byte) (*plugins.Result, error) {
+	var out callbackOutput
+	if err := json.Unmarshal(content, &out); err != nil {
+		return nil, fmt.Errorf("unable to parse ansible-playbook results: %s", err)
+	}
+	hosts := map[string]*plugins.HostResult{}
+	host := func(name string) *plugins.HostResult {
+		if hosts[name] == nil {
+			hosts[name] = &plugins.HostResult{Name: name, Status: plugins.STATUS_OK}
+		}
+		return hosts[name]
+	}
+	for _, play := range out.Plays {
+		for _, task := range play.Tasks {
+			names := make([]string, 0, len(task.Hosts))
+			for name := range task.Hosts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				r := task.Hosts[name]
+				t := &plugins.TaskResult{Name: task.Task.Name, Status: plugins.STATUS_OK}
+				switch {
+				case r.Unreachable:
+					t.Status = plugins.STATUS_UNREACHABLE
+				case r.Failed:
+					t.Status = plugins.STATUS_FAILED
+				case r.Skipped:
+					t.Status = plugins.STATUS_SKIPPED
+				case r.Changed:
+					t.Status = plugins.STATUS_CHANGED
+				}
+				if r.Msg != nil && t.Status != plugins.STATUS_OK && t.Status != plugins.STATUS_SKIPPED {
+					t.Msg = fmt.Sprint(r.Msg)
+				}
+				host(name).Tasks = append(host(name).Tasks, t)
+			}
+		}
+	}
+	for name, s := range out.Stats {
+		h := host(name)
+		switch {
+		case s.Unreachable > 0:
+			h.Status = plugins.STATUS_UNREACHABLE
+		case s.Failures > 0:
+			h.Status = plugins.STATUS_FAILED
+		case s.Changed > 0:
+			h.Status = plugins.STATUS_CHANGED
+		}
+	}
+	result := &plugins.Result{}
+	for _, h := range hosts {
+		result.Hosts = append(result.Hosts, h)
+	}
+	sort.Slice(result.Hosts, func(i, j int) bool { return result.Hosts[i].Name < result.Hosts[j].Name })
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+// ImageBuild builds an app's image before it is deployed. Tag is rendered
+// like container params and becomes the app's image.
+type ImageBuild struct {
+	Context    string            `json:"context"`
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	Args       map[string]string `json:"args,omitempty"`
+	Tag        string            `json:"tag,omitempty"`
+}
+
+// Configure resolves Context against baseDir, when known, and Dockerfile
+// against Context.
+func (b *ImageBuild) Configure(baseDir string) error {
+	if b.Tag == "" {
+		return errors.New(utilities.UNKNOWN_BUILD_TAG)
+	}
+	if b.Context == "" {
+		b.Context = "."
+	}
+	if baseDir != "" && !filepath.IsAbs(b.Context) {
+		b.Context = filepath.Join(baseDir, b.Context)
+	}
+	if b.Dockerfile != "" && !filepath.IsAbs(b.Dockerfile) {
+		b.Dockerfile = filepath.Join(b.Context, b.Dockerfile)
+	}
+	return nil
+}
+
+// Params are the arguments of docker build.
+func (b *ImageBuild) Params() []string {
+	params := []string{"build", "-t", b.Tag}
+	if b.Dockerfile != "" {
+		params = append(params, "-f", b.Dockerfile)
+	}
+	keys := make([]string, 0, len(b.Args))
+	for k := range b.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		params = append(params, "--build-arg", k+"="+b.Args[k])
+	}
+	return append(params, b.Context)
+}
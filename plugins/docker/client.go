@@ -0,0 +1,281 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+const DEFAULT_HOST = "unix:///var/run/docker.sock"
+
+// client speaks the subset of the Docker Engine HTTP API the plugin needs.
+type client struct {
+	base string
+	http *http.Client
+	// remote is the engine's host name, empty for a local socket
+	remote string
+}
+
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("docker engine returned %d: %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.Status == http.StatusNotFound
+}
+
+func newClient(host string) (*client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		}
+		return &client{base: "http://docker", http: &http.Client{Transport: transport}}, nil
+	case "tcp", "http":
+		return &client{base: "http://" + u.Host, http: http.DefaultClient, remote: u.Hostname()}, nil
+	case "https":
+		return &client{base: "https://" + u.Host, http: http.DefaultClient, remote: u.Hostname()}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host %s", host)
+}
+
+// local tells whether the engine runs on this machine, where the plugin
+// can read what it mounts.
+func (c *client) local() bool {
+	if c.remote == "" || c.remote == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(c.remote)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *client) do(method, path string, in, out interface{}) error {
+	return c.doHeader(method, path, nil, in, out)
+}
+
+func (c *client) doHeader(method, path string, header http.Header, in, out interface{}) error {
+	res, err := c.request(method, path, header, in)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out != nil {
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	return err
+}
+
+// request sends in as JSON and returns the response of a successful
+// call, whose body the caller closes.
+func (c *client) request(method, path string, header http.Header, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusNotModified {
+		defer res.Body.Close()
+		msg, _ := ioutil.ReadAll(res.Body)
+		var e struct{ Message string }
+		if json.Unmarshal(msg, &e) == nil && e.Message != "" {
+			msg = []byte(e.Message)
+		}
+		return nil, &apiError{Status: res.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return res, nil
+}
+
+type containerJSON struct {
+	Id     string
+	State  struct{ Running bool }
+	Config struct {
+		Labels map[string]string
+	}
+}
+
+type portBinding struct {
+	HostIp   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+type hostConfig struct {
+	Binds         []string                 `json:"Binds,omitempty"`
+	Links         []string                 `json:"Links,omitempty"`
+	PortBindings  map[string][]portBinding `json:"PortBindings,omitempty"`
+	RestartPolicy *restartPolicy           `json:"RestartPolicy,omitempty"`
+	NetworkMode   string                   `json:"NetworkMode,omitempty"`
+}
+
+type networkingConfig struct {
+	EndpointsConfig map[string]*endpointConfig `json:"EndpointsConfig"`
+}
+
+type endpointConfig struct {
+	Aliases []string `json:"Aliases,omitempty"`
+}
+
+type restartPolicy struct {
+	Name              string `json:"Name"`
+	MaximumRetryCount int    `json:"MaximumRetryCount,omitempty"`
+}
+
+type containerConfig struct {
+	Image        string              `json:"Image"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Hostname     string              `json:"Hostname,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	HostConfig   hostConfig          `json:"HostConfig"`
+	// NetworkingConfig sets the aliases on the network of HostConfig
+	NetworkingConfig *networkingConfig `json:"NetworkingConfig,omitempty"`
+}
+
+func (c *client) inspect(name string) (*containerJSON, error) {
+	var out containerJSON
+	if err := c.do("GET", "/containers/"+url.PathEscape(name)+"/json", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// pull fetches the image, authenticating with the registry when given.
+// The tag defaults to latest, since the engine pulls every tag without
+// one, and errors reported in the progress stream fail the pull.
+func (c *client) pull(image string, registry *plugins.Registry) error {
+	header := http.Header{}
+	if registry != nil {
+		header.Set("X-Registry-Auth", registry.Auth())
+	}
+	ref := utilities.ParseImage(image)
+	tag := ref.Tag
+	if ref.Digest != "" {
+		tag = ref.Digest
+	}
+	query := url.Values{"fromImage": {ref.Name()}, "tag": {tag}}
+	res, err := c.request("POST", "/images/create?"+query.Encode(), header, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var msg struct {
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pulling %s: %s", image, msg.Error)
+		}
+		if msg.ErrorDetail.Message != "" {
+			return fmt.Errorf("pulling %s: %s", image, msg.ErrorDetail.Message)
+		}
+	}
+}
+
+func (c *client) create(name string, config *containerConfig) (string, error) {
+	var out struct{ Id string }
+	err := c.do("POST", "/containers/create?name="+url.QueryEscape(name), config, &out)
+	return out.Id, err
+}
+
+func (c *client) start(id string) error {
+	return c.do("POST", "/containers/"+url.PathEscape(id)+"/start", nil, nil)
+}
+
+func (c *client) stop(id string) error {
+	return c.do("POST", "/containers/"+url.PathEscape(id)+"/stop", nil, nil)
+}
+
+func (c *client) remove(id string) error {
+	return c.do("DELETE", "/containers/"+url.PathEscape(id)+"?force=1", nil, nil)
+}
+
+// ensureNetwork creates the network unless it exists.
+func (c *client) ensureNetwork(n *plugins.Network) error {
+	err := c.do("GET", "/networks/"+url.PathEscape(n.Name), nil, nil)
+	if !isNotFound(err) {
+		return err
+	}
+	return c.do("POST", "/networks/create", map[string]interface{}{
+		"Name": n.Name, "Driver": n.Driver, "CheckDuplicate": true,
+	}, nil)
+}
+
+func (c *client) connect(n *plugins.Network, id string) error {
+	return c.do("POST", "/networks/"+url.PathEscape(n.Name)+"/connect", map[string]interface{}{
+		"Container": id, "EndpointConfig": &endpointConfig{Aliases: n.Aliases},
+	}, nil)
+}
+
+func (c *client) volumeMountpoint(name string) (string, error) {
+	var out struct{ Mountpoint string }
+	if err := c.do("GET", "/volumes/"+url.PathEscape(name), nil, &out); err != nil {
+		return "", err
+	}
+	return out.Mountpoint, nil
+}
+
+type engineInfo struct {
+	Name, OSType, Architecture string
+	NCPU                       int
+	MemTotal                   int64
+	Swarm                      struct{ NodeAddr string }
+}
+
+func (c *client) info() (*engineInfo, error) {
+	var out engineInfo
+	if err := c.do("GET", "/info", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
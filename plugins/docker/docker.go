@@ -0,0 +1,422 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aminjam/hipops/inventory"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+var Instance plugins.Plugin
+
+type instance struct {
+	client *client
+	facts  map[string]string
+}
+
+func init() {
+	Instance = &instance{}
+}
+func (i *instance) DefaultPlay() string {
+	return "docker"
+}
+func (i *instance) Mask(input string) string {
+	return input
+}
+func (i *instance) Unmask(input string) string {
+	return input
+}
+func (i *instance) Run(a *plugins.Action) error {
+	if i.client == nil {
+		return errors.New("docker plugin is not configured")
+	}
+	shipped := a.Repository != nil && a.Repository.Shipped()
+	if !i.client.local() {
+		// dest, files and repositories are written on this machine, which
+		// is not where the engine mounts them from
+		if shipped || len(a.Files) != 0 {
+			return fmt.Errorf("%s: the docker plugin writes files and repositories on this machine, not on the docker host %s; use the ssh plugin for remote hosts", a.Name, i.client.remote)
+		}
+	} else if err := os.MkdirAll(a.Dest, 0755); err != nil {
+		return err
+	}
+	if r := a.Repository; shipped {
+		archive, err := os.Open(r.Archive)
+		if err != nil {
+			return err
+		}
+		err = utilities.Untar(archive, r.Path(a.Dest))
+		archive.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range a.Files {
+		if err := copyFile(f); err != nil {
+			return err
+		}
+	}
+	for _, n := range a.Networks {
+		if err := i.client.ensureNetwork(n); err != nil {
+			return fmt.Errorf("network %s: %s", n.Name, err)
+		}
+	}
+	containers := a.Containers
+	if len(plugins.FactsOf(containers)) != 0 {
+		if err := i.gatherFacts(a); err != nil {
+			return err
+		}
+		containers = plugins.ResolveContainers(containers, func(f *plugins.Fact) string {
+			return i.facts[f.Name]
+		})
+	}
+	for _, c := range containers {
+		fmt.Println("Running...", c.Name, c.State)
+		if err := i.apply(c, a.Registry); err != nil {
+			return fmt.Errorf("%s: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+func (i *instance) ValidateParams(args ...string) error {
+	host := DEFAULT_HOST
+	if len(args) > 0 && args[0] != "" {
+		host = args[0]
+	}
+	c, err := newClient(host)
+	if err != nil {
+		return err
+	}
+	i.client = c
+	i.facts = nil
+	return nil
+}
+
+// gatherFacts asks the engine about its host once per run. The ip is the
+// address of a remote engine, the engine's swarm node address or the
+// address of the action's inventory host, and only when none is known the
+// address this machine reaches out from.
+func (i *instance) gatherFacts(a *plugins.Action) error {
+	if i.facts != nil {
+		return nil
+	}
+	info, err := i.client.info()
+	if err != nil {
+		return err
+	}
+	ip := info.Swarm.NodeAddr
+	if i.client.remote != "" {
+		addrs, err := net.LookupHost(i.client.remote)
+		if err != nil {
+			return err
+		}
+		ip = addrs[0]
+	}
+	if ip == "" {
+		ip = inventoryAddress(a)
+	}
+	if ip == "" {
+		conn, err := net.Dial("udp", "1.1.1.1:53")
+		if err != nil {
+			return fmt.Errorf("the host ip is unknown: %s", err)
+		}
+		ip = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+	i.facts = map[string]string{
+		"hostname": strings.SplitN(info.Name, ".", 2)[0],
+		"fqdn":     info.Name,
+		"ip":       ip,
+		"os":       info.OSType,
+		"arch":     info.Architecture,
+		"cpus":     strconv.Itoa(info.NCPU),
+		"memory":   strconv.FormatInt(info.MemTotal/1024/1024, 10),
+	}
+	return nil
+}
+
+// inventoryAddress is the ip of the first host of the action's inventory
+// group that is not the loopback, empty when there is none.
+func inventoryAddress(a *plugins.Action) string {
+	inv := a.Hosts
+	if inv == nil && a.InventoryFile != "" {
+		inv, _ = inventory.Load(a.InventoryFile)
+	}
+	if inv == nil {
+		return ""
+	}
+	hosts, _ := inv.Hosts(a.Inventory)
+	for _, h := range hosts {
+		addrs, err := net.LookupHost(h.Address)
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(addrs[0]); ip != nil && !ip.IsLoopback() {
+			return addrs[0]
+		}
+	}
+	return ""
+}
+
+func (i *instance) apply(c *plugins.Container, registry *plugins.Registry) error {
+	existing, err := i.client.inspect(c.Name)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	switch c.State {
+	case utilities.ABSENT_APP_STATE:
+		if existing != nil {
+			return i.client.remove(existing.Id)
+		}
+		return nil
+	case utilities.STOPPED_APP_STATE:
+		if existing != nil && existing.State.Running {
+			return i.client.stop(existing.Id)
+		}
+		return nil
+	}
+	if existing != nil {
+		if c.State != utilities.REDEPLOY_APP_STATE && existing.Config.Labels[plugins.HASH_LABEL] == c.Hash() {
+			if existing.State.Running {
+				return nil
+			}
+			return i.client.start(existing.Id)
+		}
+	}
+	config, err := toConfig(c)
+	if err != nil {
+		return err
+	}
+	// the old container keeps running when the new image cannot be pulled
+	if err = i.client.pull(config.Image, registry); err != nil {
+		return err
+	}
+	if existing != nil {
+		for _, v := range c.Backup {
+			if err = i.snapshot(v); err != nil {
+				return fmt.Errorf("snapshot of %s: %s", v.Name, err)
+			}
+		}
+		if err = i.client.remove(existing.Id); err != nil {
+			return err
+		}
+	}
+	id, err := i.client.create(c.Name, config)
+	if err != nil {
+		return err
+	}
+	for _, n := range c.Connect {
+		if err = i.client.connect(n, id); err != nil {
+			return fmt.Errorf("network %s: %s", n.Name, err)
+		}
+	}
+	return i.client.start(id)
+}
+
+func toConfig(c *plugins.Container) (*containerConfig, error) {
+	p, err := plugins.ParseParams(c.Params)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Extra) != 0 {
+		return nil, fmt.Errorf("unsupported docker flags %s", strings.Join(p.Extra, " "))
+	}
+	config := &containerConfig{
+		Image:      p.Image,
+		Cmd:        p.Cmd,
+		Env:        p.Env,
+		Hostname:   p.Hostname,
+		WorkingDir: p.Workdir,
+		Labels:     map[string]string{plugins.HASH_LABEL: c.Hash()},
+	}
+	config.HostConfig.Binds = p.Volumes
+	config.HostConfig.Links = p.Links
+	if p.Network != "" {
+		config.HostConfig.NetworkMode = p.Network
+		config.NetworkingConfig = &networkingConfig{EndpointsConfig: map[string]*endpointConfig{
+			p.Network: {Aliases: p.NetworkAliases},
+		}}
+	}
+	if p.Restart != "" {
+		policy := strings.SplitN(p.Restart, ":", 2)
+		config.HostConfig.RestartPolicy = &restartPolicy{Name: policy[0]}
+		if len(policy) == 2 {
+			config.HostConfig.RestartPolicy.MaximumRetryCount, _ = strconv.Atoi(policy[1])
+		}
+	}
+	for _, port := range p.Ports {
+		parts := strings.Split(port, ":")
+		container := parts[len(parts)-1]
+		if !strings.Contains(container, "/") {
+			container += "/tcp"
+		}
+		binding := portBinding{}
+		switch len(parts) {
+		case 2:
+			binding.HostPort = parts[0]
+		case 3:
+			binding.HostIp, binding.HostPort = parts[0], parts[1]
+		}
+		if config.ExposedPorts == nil {
+			config.ExposedPorts = map[string]struct{}{}
+			config.HostConfig.PortBindings = map[string][]portBinding{}
+		}
+		config.ExposedPorts[container] = struct{}{}
+		config.HostConfig.PortBindings[container] = append(config.HostConfig.PortBindings[container], binding)
+	}
+	return config, nil
+}
+
+func copyFile(f *plugins.Customization) error {
+	if err := os.MkdirAll(f.DestFolder, 0755); err != nil {
+		return err
+	}
+	src, err := os.Open(f.Src)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := os.OpenFile(f.Dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.FileMode())
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	if _, err = io.Copy(dest, src); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Dest, f.FileMode()); err != nil {
+		return err
+	}
+	if f.Owner == "" && f.Group == "" {
+		return nil
+	}
+	uid, gid, err := lookupOwner(f.Owner, f.Group)
+	if err != nil {
+		return err
+	}
+	return os.Chown(f.Dest, uid, gid)
+}
+
+// lookupOwner resolves user and group names or ids; -1 leaves one unchanged.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// volumeDir is where the volume's data is on this machine. Host paths and
+// mountpoints are the engine's, so they are only read with a local engine.
+func (i *instance) volumeDir(v *plugins.Volume) (string, error) {
+	if !i.client.local() {
+		return "", fmt.Errorf("volume %s is on the docker host %s; the docker plugin snapshots and restores volumes of a local engine only", v.Name, i.client.remote)
+	}
+	if v.Path != "" {
+		return v.Path, nil
+	}
+	dir, err := i.client.volumeMountpoint(v.Source())
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(dir); err != nil {
+		return "", fmt.Errorf("volume %s cannot be read at its mountpoint: %s", v.Name, err)
+	}
+	return dir, nil
+}
+
+// snapshot writes the volume as a timestamped tarball into its snapshot
+// directory.
+func (i *instance) snapshot(v *plugins.Volume) error {
+	dir, err := i.volumeDir(v)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	if err = os.MkdirAll(v.SnapshotDir, 0700); err != nil {
+		return err
+	}
+	name := filepath.Join(v.SnapshotDir, v.SnapshotPrefix()+time.Now().UTC().Format(plugins.SNAPSHOT_TIME)+".tar.gz")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Println("Snapshot...", name)
+	return utilities.Tarball(dir, f)
+}
+
+// RestoreVolume stops the action's containers, replaces the volume's
+// content with the snapshot, the latest one when it is empty, and starts
+// them again.
+func (i *instance) RestoreVolume(a *plugins.Action, v *plugins.Volume, snapshot string) error {
+	if snapshot == "" {
+		matches, _ := filepath.Glob(filepath.Join(v.SnapshotDir, v.SnapshotPrefix()+"*.tar.gz"))
+		if len(matches) == 0 {
+			return fmt.Errorf("no snapshot of %s in %s", v.Name, v.SnapshotDir)
+		}
+		sort.Strings(matches)
+		snapshot = matches[len(matches)-1]
+	} else {
+		snapshot = filepath.Join(v.SnapshotDir, snapshot)
+	}
+	archive, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	dir, err := i.volumeDir(v)
+	if err != nil {
+		return err
+	}
+	for _, c := range a.Containers {
+		if err = i.client.stop(c.Name); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, e := range entries {
+		if err = os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err = utilities.Untar(archive, dir); err != nil {
+		return err
+	}
+	for _, c := range a.Containers {
+		if err = i.client.start(c.Name); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	fmt.Println("Restored", snapshot)
+	return nil
+}
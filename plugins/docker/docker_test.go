@@ -0,0 +1,310 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aminjam/hipops/inventory"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+type fakeContainer struct {
+	config  containerConfig
+	running bool
+}
+
+// fakeEngine serves the Engine API endpoints the plugin uses.
+type fakeEngine struct {
+	sync.Mutex
+	containers map[string]*fakeContainer
+	calls      []string
+	auth       string
+	networks   map[string][]string
+	pulled     []string
+	swarm      string
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+	e.calls = append(e.calls, r.Method+" "+r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/info":
+		fmt.Fprintf(w, `{"Name":"box.example.com","OSType":"linux","Architecture":"x86_64","NCPU":4,"MemTotal":2147483648,"Swarm":{"NodeAddr":%q}}`, e.swarm)
+	case r.URL.Path == "/networks/create":
+		var network struct{ Name string }
+		json.NewDecoder(r.Body).Decode(&network)
+		e.networks[network.Name] = []string{}
+	case len(parts) >= 2 && parts[0] == "networks":
+		if _, ok := e.networks[parts[1]]; !ok {
+			http.Error(w, `{"message":"no such network"}`, http.StatusNotFound)
+		} else if len(parts) == 3 && parts[2] == "connect" {
+			var connect struct {
+				Container      string
+				EndpointConfig endpointConfig
+			}
+			json.NewDecoder(r.Body).Decode(&connect)
+			e.networks[parts[1]] = append(e.networks[parts[1]], connect.Container+":"+strings.Join(connect.EndpointConfig.Aliases, ","))
+		}
+	case r.URL.Path == "/images/create":
+		e.auth = r.Header.Get("X-Registry-Auth")
+		e.pulled = append(e.pulled, r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag"))
+		if strings.HasPrefix(r.URL.Query().Get("fromImage"), "missing") {
+			w.Write([]byte("{\"status\":\"Pulling\"}\n{\"errorDetail\":{\"message\":\"manifest unknown\"},\"error\":\"manifest unknown\"}\n"))
+			return
+		}
+		w.Write([]byte(`{"status":"pulled"}`))
+	case r.URL.Path == "/containers/create":
+		var config containerConfig
+		json.NewDecoder(r.Body).Decode(&config)
+		name := r.URL.Query().Get("name")
+		e.containers[name] = &fakeContainer{config: config}
+		json.NewEncoder(w).Encode(map[string]string{"Id": name})
+	case len(parts) >= 2 && parts[0] == "containers":
+		c, ok := e.containers[parts[1]]
+		if !ok {
+			http.Error(w, `{"message":"no such container"}`, http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == "DELETE":
+			delete(e.containers, parts[1])
+		case parts[2] == "json":
+			out := containerJSON{Id: parts[1]}
+			out.State.Running = c.running
+			out.Config.Labels = c.config.Labels
+			json.NewEncoder(w).Encode(out)
+		case parts[2] == "start":
+			c.running = true
+		case parts[2] == "stop":
+			c.running = false
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDockerPlugin_implements(t *testing.T) {
+	var _ plugins.Plugin = &instance{}
+}
+
+func TestDockerPlugin_run(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "hipops-docker")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "nginx.conf")
+	ioutil.WriteFile(src, []byte("server {}"), 0600)
+
+	i := &instance{}
+	spec.Expect(i.ValidateParams(strings.Replace(server.URL, "http://", "tcp://", 1))).ToEqual(nil)
+
+	container := &plugins.Container{
+		Name:   "0-db-mongo",
+		State:  utilities.DEFAULT_APP_STATE,
+		Params: "--name 0-db-mongo -v /data/db:/home/app -p 9990:27017 -e MONGO_OPTIONS='--smallfiles' -d aminjam/mongodb:latest /run.sh",
+	}
+	file := &plugins.Customization{Src: src, Dest: dir + "/app/conf/nginx.conf", DestFolder: dir + "/app/conf", Mode: 0640}
+	action := &plugins.Action{Dest: dir + "/app", Files: []*plugins.Customization{file}, Containers: []*plugins.Container{container}}
+	spec.Expect(i.Run(action)).ToEqual(nil)
+
+	created := engine.containers["0-db-mongo"]
+	spec.Expect(created != nil, created.running).ToEqual(true, true)
+	spec.Expect(created.config.Image, created.config.Env[0], created.config.Cmd[0]).ToEqual("aminjam/mongodb:latest", "MONGO_OPTIONS=--smallfiles", "/run.sh")
+	spec.Expect(created.config.HostConfig.Binds[0]).ToEqual("/data/db:/home/app")
+	spec.Expect(created.config.HostConfig.PortBindings["27017/tcp"][0].HostPort).ToEqual("9990")
+	info, err := os.Stat(file.Dest)
+	spec.Expect(err, info.Mode().Perm()).ToEqual(nil, os.FileMode(0640))
+
+	// an unchanged running container is left alone
+	engine.calls = nil
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	spec.Expect(len(engine.calls)).ToEqual(1)
+
+	container.State = utilities.STOPPED_APP_STATE
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	spec.Expect(engine.containers["0-db-mongo"].running).ToEqual(false)
+
+	container.State = utilities.DEFAULT_APP_STATE
+	container.Params = strings.Replace(container.Params, "9990", "9991", 1)
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	spec.Expect(engine.containers["0-db-mongo"].config.HostConfig.PortBindings["27017/tcp"][0].HostPort).ToEqual("9991")
+
+	container.State = utilities.ABSENT_APP_STATE
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	_, ok := engine.containers["0-db-mongo"]
+	spec.Expect(ok).ToEqual(false)
+
+	// files are written here, so a remote engine could not mount them
+	remote := &instance{client: &client{remote: "10.0.0.5"}}
+	action.Name = "0-db-mongo"
+	spec.ExpectString(remote.Run(action).Error()).ToContain("0-db-mongo: the docker plugin writes files and repositories on this machine, not on the docker host 10.0.0.5")
+}
+
+func TestDockerPlugin_unsupportedFlags(t *testing.T) {
+	_, err := toConfig(&plugins.Container{Params: "--name a --cpu-shares 2 -d image"})
+	spec := utilities.Spec(t)
+	spec.ExpectString(err.Error()).ToContain("--cpu-shares 2")
+
+	_, err = toConfig(&plugins.Container{Params: "--name a --init image"})
+	spec.ExpectString(err.Error()).ToContain("unsupported docker flags --init")
+	_, err = toConfig(&plugins.Container{Params: "--name a --frobnicate image"})
+	spec.ExpectString(err.Error()).ToContain("unknown docker run flag --frobnicate")
+}
+
+func TestDockerPlugin_pull(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	c, _ := newClient(server.URL)
+	spec.Expect(c.pull("aminjam/mongodb", nil), c.pull("mongo:4@sha256:abc", nil)).ToEqual(nil, nil)
+	spec.Expect(strings.Join(engine.pulled, " ")).ToEqual("aminjam/mongodb:latest mongo:sha256:abc")
+	spec.ExpectString(c.pull("missing/image:v1", nil).Error()).ToContain("pulling missing/image:v1: manifest unknown")
+
+	// a failed pull leaves the old container in place
+	i := &instance{client: c}
+	container := &plugins.Container{Name: "api", State: utilities.DEFAULT_APP_STATE, Params: "--name api -d aminjam/nodejs:v1"}
+	spec.Expect(i.apply(container, nil)).ToEqual(nil)
+	container.Params = "--name api -d missing/nodejs:v2"
+	spec.ExpectString(i.apply(container, nil).Error()).ToContain("manifest unknown")
+	spec.Expect(engine.containers["api"].config.Image).ToEqual("aminjam/nodejs:v1")
+}
+
+func TestDockerPlugin_hostFacts(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	i := &instance{}
+	spec.Expect(i.ValidateParams(strings.Replace(server.URL, "http://", "tcp://", 1))).ToEqual(nil)
+	container := &plugins.Container{
+		Name:   "web",
+		State:  utilities.DEFAULT_APP_STATE,
+		Params: "--name web -h @HOST(hostname) -e ADVERTISE=@HOST(ip):80 -e MEMORY=@HOST(memory) -d nginx",
+	}
+	action := &plugins.Action{Dest: os.TempDir(), Containers: []*plugins.Container{container}}
+	spec.Expect(i.Run(action)).ToEqual(nil)
+
+	created := engine.containers["web"]
+	spec.Expect(created.config.Hostname, created.config.Env[0], created.config.Env[1]).ToEqual("box", "ADVERTISE=127.0.0.1:80", "MEMORY=2048")
+	spec.ExpectString(container.Params).ToContain("@HOST(ip)")
+
+	// a local engine knows its address from swarm, or else the inventory
+	dir, _ := ioutil.TempDir("", "hipops-docker")
+	defer os.RemoveAll(dir)
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	spec.Expect(err).ToEqual(nil)
+	local := &httptest.Server{Listener: listener, Config: &http.Server{Handler: engine}}
+	local.Start()
+	defer local.Close()
+	hosts := inventory.New()
+	hosts.AddHost("demo", "box", map[string]string{"ansible_host": "10.0.0.4"})
+	for _, swarm := range []string{"10.0.0.9", ""} {
+		engine.swarm = swarm
+		i := &instance{}
+		spec.Expect(i.ValidateParams("unix://" + filepath.Join(dir, "docker.sock"))).ToEqual(nil)
+		container := &plugins.Container{Name: "web", State: utilities.DEFAULT_APP_STATE, Params: "--name web -e ADVERTISE=@HOST(ip) -d nginx"}
+		spec.Expect(i.Run(&plugins.Action{Dest: dir, Inventory: "demo", Hosts: hosts, Containers: []*plugins.Container{container}})).ToEqual(nil)
+		expected := swarm
+		if swarm == "" {
+			expected = "10.0.0.4"
+		}
+		spec.Expect(engine.containers["web"].config.Env[0]).ToEqual("ADVERTISE=" + expected)
+	}
+}
+
+func TestDockerPlugin_registry(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	i := &instance{}
+	spec.Expect(i.ValidateParams(strings.Replace(server.URL, "http://", "tcp://", 1))).ToEqual(nil)
+	container := &plugins.Container{Name: "api", State: utilities.DEFAULT_APP_STATE, Params: "--name api -d registry.example.com/team/api:v1"}
+	registry := &plugins.Registry{Server: "registry.example.com", Username: "deploy", Password: "s3cret"}
+	action := &plugins.Action{Dest: os.TempDir(), Containers: []*plugins.Container{container}, Registry: registry}
+	spec.Expect(i.Run(action)).ToEqual(nil)
+
+	auth, err := base64.URLEncoding.DecodeString(engine.auth)
+	spec.Expect(err, string(auth)).ToEqual(nil, `{"password":"s3cret","serveraddress":"registry.example.com","username":"deploy"}`)
+}
+
+func TestDockerPlugin_networks(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}, networks: map[string][]string{"frontend": {}}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	i := &instance{}
+	spec.Expect(i.ValidateParams(strings.Replace(server.URL, "http://", "tcp://", 1))).ToEqual(nil)
+	backend := &plugins.Network{Name: "backend", Aliases: []string{"db", "mongo"}}
+	frontend := &plugins.Network{Name: "frontend", Aliases: []string{"api"}}
+	container := &plugins.Container{Name: "mongo", State: utilities.DEFAULT_APP_STATE, Params: "--name mongo -d aminjam/mongodb:latest"}
+	spec.Expect(container.Attach([]*plugins.Network{backend, frontend})).ToEqual(nil)
+	action := &plugins.Action{Dest: os.TempDir(), Containers: []*plugins.Container{container}, Networks: []*plugins.Network{backend, frontend}}
+	spec.Expect(i.Run(action)).ToEqual(nil)
+
+	config := engine.containers["mongo"].config
+	spec.Expect(config.HostConfig.NetworkMode, strings.Join(config.NetworkingConfig.EndpointsConfig["backend"].Aliases, ",")).ToEqual("backend", "db,mongo")
+	spec.Expect(len(engine.networks["backend"]), engine.networks["frontend"][0]).ToEqual(0, "mongo:api")
+}
+
+func TestDockerPlugin_volumes(t *testing.T) {
+	spec := utilities.Spec(t)
+	engine := &fakeEngine{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "hipops-volumes")
+	defer os.RemoveAll(dir)
+	i := &instance{}
+	spec.Expect(i.ValidateParams(strings.Replace(server.URL, "http://", "tcp://", 1))).ToEqual(nil)
+	volume := &plugins.Volume{Name: "data", Path: filepath.Join(dir, "db"), Target: "/data/db", BackupBeforeDeploy: true}
+	spec.Expect(volume.Configure("mongo", dir, filepath.Join(dir, "snapshots"))).ToEqual(nil)
+	container := &plugins.Container{Name: "mongo", State: utilities.DEFAULT_APP_STATE, Params: "--name mongo -d aminjam/mongodb:latest"}
+	spec.Expect(container.Mount([]*plugins.Volume{volume})).ToEqual(nil)
+	action := &plugins.Action{Dest: dir, Containers: []*plugins.Container{container}, Volumes: []*plugins.Volume{volume}}
+
+	// a new container has nothing to snapshot
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	spec.Expect(engine.containers["mongo"].config.HostConfig.Binds[0]).ToEqual(volume.Path + ":/data/db")
+	os.MkdirAll(volume.Path, 0700)
+	ioutil.WriteFile(filepath.Join(volume.Path, "collection"), []byte("v1"), 0600)
+
+	container.State = utilities.REDEPLOY_APP_STATE
+	spec.Expect(i.Run(action)).ToEqual(nil)
+	snapshots, _ := filepath.Glob(filepath.Join(dir, "snapshots", "data-*.tar.gz"))
+	spec.Expect(len(snapshots)).ToEqual(1)
+
+	ioutil.WriteFile(filepath.Join(volume.Path, "collection"), []byte("broken"), 0600)
+	ioutil.WriteFile(filepath.Join(volume.Path, "extra"), []byte("new"), 0600)
+	spec.Expect(i.RestoreVolume(action, volume, "")).ToEqual(nil)
+	content, _ := ioutil.ReadFile(filepath.Join(volume.Path, "collection"))
+	_, err := os.Stat(filepath.Join(volume.Path, "extra"))
+	spec.Expect(string(content), os.IsNotExist(err), engine.containers["mongo"].running).ToEqual("v1", true, true)
+
+	spec.ExpectString(i.RestoreVolume(action, volume, "data-missing.tar.gz").Error()).ToContain("no such file")
+
+	remote := &instance{client: &client{remote: "10.0.0.5"}}
+	spec.ExpectString(remote.snapshot(volume).Error()).ToContain("volume data is on the docker host 10.0.0.5")
+	spec.ExpectString(remote.RestoreVolume(action, volume, "").Error()).ToContain("local engine only")
+}
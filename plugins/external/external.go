@@ -0,0 +1,172 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/aminjam/hipops/plugins"
+)
+
+// Prefix is prepended to a plugin name to find its executable on PATH.
+const Prefix = "hipops-plugin-"
+
+// Request is written as a single JSON document to the plugin's stdin.
+type Request struct {
+	Method string   `json:"method"`
+	Input  string   `json:"input,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Action *action  `json:"action,omitempty"`
+}
+
+// Response is read line by line from the plugin's stdout. Lines carrying
+// Log are streamed to the user, the first line without it ends the call.
+type Response struct {
+	Log    string `json:"log,omitempty"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// action exposes the fields plugins.Action hides from extra vars.
+type action struct {
+	*plugins.Action
+	PrivateKey    string `json:"privateKey"`
+	User          string `json:"user"`
+	InventoryFile string `json:"inventoryFile"`
+	Name          string `json:"name"`
+	Suffix        string `json:"suffix"`
+	Debug         int    `json:"debug"`
+}
+
+type instance struct {
+	path string
+	args []string
+	Log  io.Writer
+	// failed is the first error of a call whose method cannot return one,
+	// returned by Err and Run
+	failed error
+}
+
+func New(path string, args ...string) plugins.Plugin {
+	return &instance{path: path, args: args, Log: os.Stdout}
+}
+
+func Lookup(name string) (plugins.Plugin, error) {
+	path, err := exec.LookPath(Prefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s is not found: %s", name, err)
+	}
+	return New(path), nil
+}
+
+func (i *instance) DefaultPlay() string {
+	res, err := i.call(&Request{Method: "DefaultPlay"})
+	if err != nil {
+		i.fail("DefaultPlay", err)
+		return ""
+	}
+	return res
+}
+func (i *instance) Mask(input string) string {
+	res, err := i.call(&Request{Method: "Mask", Input: input})
+	if err != nil {
+		i.fail("Mask", err)
+		return input
+	}
+	return res
+}
+func (i *instance) Unmask(input string) string {
+	res, err := i.call(&Request{Method: "Unmask", Input: input})
+	if err != nil {
+		i.fail("Unmask", err)
+		return input
+	}
+	return res
+}
+func (i *instance) Run(a *plugins.Action) error {
+	if i.failed != nil {
+		return i.failed
+	}
+	_, err := i.call(&Request{Method: "Run", Action: &action{
+		Action:        a,
+		PrivateKey:    a.PrivateKey,
+		User:          a.User,
+		InventoryFile: a.InventoryFile,
+		Name:          a.Name,
+		Suffix:        a.Suffix,
+		Debug:         a.Debug,
+	}})
+	return err
+}
+func (i *instance) ValidateParams(args ...string) error {
+	_, err := i.call(&Request{Method: "ValidateParams", Args: args})
+	return err
+}
+
+// Err is the first failure of DefaultPlay, Mask or Unmask.
+func (i *instance) Err() error {
+	return i.failed
+}
+
+// fail keeps the first error of a call for Err and Run, so a broken plugin
+// never deploys what it failed to mask.
+func (i *instance) fail(method string, err error) {
+	if i.failed == nil {
+		i.failed = fmt.Errorf("plugin %s: %s: %s", i.path, method, err)
+	}
+}
+
+func (i *instance) call(req *Request) (string, error) {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(i.path, i.args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err = cmd.Start(); err != nil {
+		return "", err
+	}
+	stdin.Write(content)
+	stdin.Close()
+
+	var res *Response
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for res == nil && scanner.Scan() {
+		var line Response
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return "", fmt.Errorf("%s: invalid response: %s", req.Method, err)
+		}
+		if line.Log != "" {
+			fmt.Fprintln(i.Log, line.Log)
+			continue
+		}
+		res = &line
+	}
+	io.Copy(ioutil.Discard, stdout)
+	if err = cmd.Wait(); err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", fmt.Errorf("%s: plugin exited without a response", req.Method)
+	}
+	if res.Error != "" {
+		return "", errors.New(res.Error)
+	}
+	return res.Result, nil
+}
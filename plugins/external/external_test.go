@@ -0,0 +1,83 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+func helperPlugin(log *bytes.Buffer) plugins.Plugin {
+	i := New(os.Args[0], "-test.run=TestHelperProcess", "--", "helper").(*instance)
+	i.Log = log
+	return i
+}
+
+func TestExternalPlugin_implements(t *testing.T) {
+	var _ plugins.Plugin = &instance{}
+}
+
+func TestExternalPlugin_protocol(t *testing.T) {
+	spec := utilities.Spec(t)
+	log := new(bytes.Buffer)
+	p := helperPlugin(log)
+
+	spec.Expect(p.DefaultPlay()).ToEqual("external.yml")
+	spec.Expect(p.Mask("{{ box_ip }}")).ToEqual("@EXT ip }}")
+	spec.Expect(p.Unmask("@EXT ip }}")).ToEqual("{{ box_ip }}")
+	spec.Expect(p.ValidateParams("ok")).ToEqual(nil)
+	spec.ExpectString(p.ValidateParams("bad").Error()).ToContain("bad param")
+
+	err := p.Run(&plugins.Action{Name: "mongo", User: "core", Dest: "/data"})
+	spec.Expect(err).ToEqual(nil)
+	spec.ExpectString(log.String()).ToContain("deploying mongo as core to /data")
+}
+
+func TestExternalPlugin_failedMask(t *testing.T) {
+	spec := utilities.Spec(t)
+	p := helperPlugin(new(bytes.Buffer))
+	spec.Expect(p.Mask("{{ box_fail }}")).ToEqual("{{ box_fail }}")
+	spec.ExpectString(p.(plugins.Failer).Err().Error()).ToContain("Mask: cannot mask")
+	spec.ExpectString(p.Run(&plugins.Action{Name: "mongo"}).Error()).ToContain("cannot mask")
+}
+
+func TestHelperProcess(t *testing.T) {
+	if os.Args[len(os.Args)-1] != "helper" {
+		return
+	}
+	defer os.Exit(0)
+	var req struct {
+		Method string
+		Input  string
+		Args   []string
+		Action map[string]interface{}
+	}
+	json.NewDecoder(os.Stdin).Decode(&req)
+	res := Response{}
+	switch req.Method {
+	case "DefaultPlay":
+		res.Result = "external.yml"
+	case "Mask":
+		if strings.Contains(req.Input, "fail") {
+			res.Error = "cannot mask " + req.Input
+		}
+		res.Result = strings.Replace(req.Input, "{{ box_", "@EXT ", -1)
+	case "Unmask":
+		res.Result = strings.Replace(req.Input, "@EXT ", "{{ box_", -1)
+	case "ValidateParams":
+		if len(req.Args) > 0 && req.Args[0] == "bad" {
+			res.Error = "bad param"
+		}
+	case "Run":
+		line, _ := json.Marshal(Response{Log: fmt.Sprintf("deploying %s as %s to %s",
+			req.Action["name"], req.Action["user"], req.Action["dest"])})
+		fmt.Println(string(line))
+	}
+	out, _ := json.Marshal(res)
+	fmt.Println(string(out))
+}
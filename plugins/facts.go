@@ -0,0 +1,87 @@
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+// Fact is a property of the host a container runs on, referenced in a
+// scenario as `{{ host "ip" }}`. Jinja is how Ansible reads it from its
+// gathered facts, Shell how it is read on the host itself.
+type Fact struct {
+	Name, Jinja, Shell string
+}
+
+// Facts are the host facts every plugin can resolve.
+var Facts = []*Fact{
+	{"hostname", "ansible_hostname", "hostname -s"},
+	{"fqdn", "ansible_fqdn", "hostname -f"},
+	{"ip", "ansible_default_ipv4.address", "ip -4 route get 1.1.1.1 | sed -n 's/.* src \\([0-9.]*\\).*/\\1/p'"},
+	{"os", "ansible_system | lower", "uname -s | tr A-Z a-z"},
+	{"arch", "ansible_architecture", "uname -m"},
+	{"cpus", "ansible_processor_vcpus", "nproc"},
+	{"memory", "ansible_memtotal_mb", "awk '/^MemTotal:/ {print int($2 / 1024)}' /proc/meminfo"},
+}
+
+func findFact(name string) *Fact {
+	for _, f := range Facts {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+var factRef = regexp.MustCompile(`@HOST\(([a-z]+)\)`)
+
+// HostFact is the `host` template function. It returns the placeholder the
+// parser carries in the container params until a plugin resolves it.
+func HostFact(name string) (string, error) {
+	if findFact(name) == nil {
+		names := make([]string, len(Facts))
+		for i, f := range Facts {
+			names[i] = f.Name
+		}
+		return "", fmt.Errorf("%s %q (known facts: %s)", utilities.UNKNOWN_HOST_FACT, name, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("@HOST(%s)", name), nil
+}
+
+// FactsOf lists the facts the containers reference, once each.
+func FactsOf(containers []*Container) []*Fact {
+	facts, seen := []*Fact{}, map[string]bool{}
+	for _, c := range containers {
+		for _, m := range factRef.FindAllStringSubmatch(c.Params, -1) {
+			if f := findFact(m[1]); f != nil && !seen[f.Name] {
+				facts = append(facts, f)
+				seen[f.Name] = true
+			}
+		}
+	}
+	return facts
+}
+
+// ResolveFacts replaces every fact placeholder in input with resolve's value.
+func ResolveFacts(input string, resolve func(*Fact) string) string {
+	return factRef.ReplaceAllStringFunc(input, func(ref string) string {
+		f := findFact(factRef.FindStringSubmatch(ref)[1])
+		if f == nil {
+			return ref
+		}
+		return resolve(f)
+	})
+}
+
+// ResolveContainers returns copies of the containers with their facts
+// resolved, leaving the action's own containers untouched.
+func ResolveContainers(containers []*Container, resolve func(*Fact) string) []*Container {
+	resolved := make([]*Container, len(containers))
+	for i, c := range containers {
+		resolved[i] = c.BaseDuplicate()
+		resolved[i].Params = ResolveFacts(c.Params, resolve)
+	}
+	return resolved
+}
@@ -0,0 +1,127 @@
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+// Mode is a file mode in octal, written as "0640" or, like older
+// scenarios do, as the number 640.
+type Mode uint32
+
+func (m *Mode) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" || s == "" {
+		return nil
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 07777 {
+		return fmt.Errorf("%s %s", utilities.INVALID_FILE_MODE, b)
+	}
+	*m = Mode(v)
+	return nil
+}
+
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+func (m Mode) String() string {
+	return fmt.Sprintf("%04o", uint32(m))
+}
+
+// Chown is the owner and group in chown's owner:group form, or empty when
+// neither is set.
+func (c *Customization) Chown() string {
+	if c.Group == "" {
+		return c.Owner
+	}
+	return c.Owner + ":" + c.Group
+}
+
+// Expand lists the files a customization ships. A directory Src ships every
+// file below it and a glob every match, directories recursively, each under
+// Dest by its path relative to the directory or to the glob's parent.
+// Exclude patterns are matched against that relative path and the base name.
+func (c *Customization) Expand() ([]*Customization, error) {
+	if strings.HasPrefix(c.Src, "@BASEDIR") || strings.HasPrefix(c.Src, "http") {
+		return []*Customization{c}, nil
+	}
+	root, matches := c.Src, []string{c.Src}
+	if strings.ContainsAny(c.Src, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(c.Src); err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s %s", utilities.NO_CUSTOMIZATION_FILES, c.Src)
+		}
+		root = globRoot(c.Src)
+	} else if info, err := os.Stat(c.Src); err != nil || !info.IsDir() {
+		return []*Customization{c}, nil
+	}
+
+	files := []*Customization{}
+	for _, match := range matches {
+		err := filepath.Walk(match, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			if p != match && c.excluded(rel) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() || (p == match && c.excluded(rel)) {
+				return nil
+			}
+			file := *c
+			file.Src = p
+			file.Dest = path.Join(c.Dest, filepath.ToSlash(rel))
+			file.DestFolder = path.Dir(file.Dest)
+			file.Exclude = nil
+			files = append(files, &file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s %s", utilities.NO_CUSTOMIZATION_FILES, c.Src)
+	}
+	return files, nil
+}
+
+func (c *Customization) excluded(rel string) bool {
+	for _, pattern := range c.Exclude {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// globRoot is the part of the pattern before its first element with a
+// wildcard.
+func globRoot(pattern string) string {
+	root := filepath.Dir(pattern)
+	for strings.ContainsAny(root, "*?[") {
+		root = filepath.Dir(root)
+	}
+	return root
+}
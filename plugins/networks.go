@@ -0,0 +1,42 @@
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Network is a docker network an app's containers join, with the names
+// they are reachable by on it.
+type Network struct {
+	Name    string   `json:"name"`
+	Driver  string   `json:"driver,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// NetworkName matches the network names and aliases a scenario can use.
+var NetworkName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Attach makes the first network the container's network in its params,
+// unless the params already pick one, and leaves the other networks in
+// Connect for the plugins to connect the container to once it is created.
+func (c *Container) Attach(networks []*Network) error {
+	if len(networks) == 0 {
+		return nil
+	}
+	p, err := ParseParams(c.Params)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Name, err)
+	}
+	if p.Network != "" {
+		c.Connect = networks
+		return nil
+	}
+	flags := []string{"--network", networks[0].Name}
+	for _, alias := range networks[0].Aliases {
+		flags = append(flags, "--network-alias", alias)
+	}
+	c.Params = strings.Join(flags, " ") + " " + c.Params
+	c.Connect = networks[1:]
+	return nil
+}
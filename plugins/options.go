@@ -0,0 +1,90 @@
+package plugins
+
+import "strconv"
+
+// AnsibleOptions are passed through to ansible-playbook. They are set per
+// playbook in the scenario and by the exec flags.
+type AnsibleOptions struct {
+	Limit             string   `json:"limit"`
+	Tags              string   `json:"tags"`
+	SkipTags          string   `json:"skipTags"`
+	Forks             int      `json:"forks"`
+	Check             bool     `json:"check"`
+	Diff              bool     `json:"diff"`
+	Become            bool     `json:"become"`
+	VaultPasswordFile string   `json:"vaultPasswordFile"`
+	SshCommonArgs     string   `json:"sshCommonArgs"`
+	Args              []string `json:"args"`
+}
+
+// Merge returns a copy of o with the values set in override taking
+// precedence. Args of both are kept, o's first.
+func (o *AnsibleOptions) Merge(override *AnsibleOptions) *AnsibleOptions {
+	merged := &AnsibleOptions{}
+	if o != nil {
+		*merged = *o
+		merged.Args = append([]string{}, o.Args...)
+	}
+	if override == nil {
+		return merged
+	}
+	if override.Limit != "" {
+		merged.Limit = override.Limit
+	}
+	if override.Tags != "" {
+		merged.Tags = override.Tags
+	}
+	if override.SkipTags != "" {
+		merged.SkipTags = override.SkipTags
+	}
+	if override.Forks != 0 {
+		merged.Forks = override.Forks
+	}
+	if override.VaultPasswordFile != "" {
+		merged.VaultPasswordFile = override.VaultPasswordFile
+	}
+	if override.SshCommonArgs != "" {
+		merged.SshCommonArgs = override.SshCommonArgs
+	}
+	merged.Check = merged.Check || override.Check
+	merged.Diff = merged.Diff || override.Diff
+	merged.Become = merged.Become || override.Become
+	merged.Args = append(merged.Args, override.Args...)
+	return merged
+}
+
+// Params renders the options as ansible-playbook arguments.
+func (o *AnsibleOptions) Params() []string {
+	params := []string{}
+	if o == nil {
+		return params
+	}
+	if o.Limit != "" {
+		params = append(params, "--limit", o.Limit)
+	}
+	if o.Tags != "" {
+		params = append(params, "--tags", o.Tags)
+	}
+	if o.SkipTags != "" {
+		params = append(params, "--skip-tags", o.SkipTags)
+	}
+	if o.Forks != 0 {
+		params = append(params, "--forks", strconv.Itoa(o.Forks))
+	}
+	if o.Check {
+		params = append(params, "--check")
+	}
+	if o.Diff {
+		params = append(params, "--diff")
+	}
+	if o.Become {
+		params = append(params, "--become")
+	}
+	if o.VaultPasswordFile != "" {
+		params = append(params, "--vault-password-file", o.VaultPasswordFile)
+	}
+	if o.SshCommonArgs != "" {
+		params = append(params, "--ssh-common-args", o.SshCommonArgs)
+	}
+	return append(params, o.Args...)
+}
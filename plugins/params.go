@@ -0,0 +1,181 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RunParams is the structured form of a container's `docker run` params.
+type RunParams struct {
+	Name, Image, Hostname,
+	Restart, Workdir string
+	Detach  bool
+	Volumes []string
+	Ports   []string
+	Env     []string
+	Links   []string
+	Cmd     []string
+
+	// Network is the --network the container runs in
+	Network        string
+	NetworkAliases []string
+	// Extra keeps the flags that have no field above, in their original order.
+	Extra []string
+}
+
+var boolFlags = map[string]bool{
+	"-d": true, "--detach": true, "-i": true, "--interactive": true,
+	"-t": true, "--tty": true, "-it": true, "-ti": true, "--rm": true,
+	"-P": true, "--publish-all": true, "--privileged": true, "--init": true,
+	"--read-only": true, "--no-healthcheck": true, "--oom-kill-disable": true,
+	"--sig-proxy": true, "--disable-content-trust": true, "-q": true, "--quiet": true,
+}
+
+// valueFlags are the `docker run` flags that take a value. A flag in
+// neither list is refused rather than guessed.
+var valueFlags = map[string]bool{
+	"--name": true, "-h": true, "--hostname": true, "--restart": true,
+	"-w": true, "--workdir": true, "-v": true, "--volume": true, "-p": true,
+	"--publish": true, "-e": true, "--env": true, "--network": true, "--net": true,
+	"--network-alias": true, "--net-alias": true, "--link": true,
+	"-a": true, "--attach": true, "--add-host": true, "--annotation": true,
+	"--blkio-weight": true, "--blkio-weight-device": true, "--cap-add": true,
+	"--cap-drop": true, "--cgroup-parent": true, "--cgroupns": true, "--cidfile": true,
+	"--cpu-period": true, "--cpu-quota": true, "--cpu-rt-period": true,
+	"--cpu-rt-runtime": true, "-c": true, "--cpu-shares": true, "--cpus": true,
+	"--cpuset-cpus": true, "--cpuset-mems": true, "--detach-keys": true,
+	"--device": true, "--device-cgroup-rule": true, "--device-read-bps": true,
+	"--device-read-iops": true, "--device-write-bps": true, "--device-write-iops": true,
+	"--dns": true, "--dns-option": true, "--dns-search": true, "--domainname": true,
+	"--entrypoint": true, "--env-file": true, "--expose": true, "--gpus": true,
+	"--group-add": true, "--health-cmd": true, "--health-interval": true,
+	"--health-retries": true, "--health-start-period": true, "--health-timeout": true,
+	"--ip": true, "--ip6": true, "--ipc": true, "--isolation": true,
+	"--kernel-memory": true, "-l": true, "--label": true, "--label-file": true,
+	"--link-local-ip": true, "--log-driver": true, "--log-opt": true,
+	"--mac-address": true, "-m": true, "--memory": true, "--memory-reservation": true,
+	"--memory-swap": true, "--memory-swappiness": true, "--mount": true,
+	"--oom-score-adj": true, "--pid": true, "--pids-limit": true, "--platform": true,
+	"--pull": true, "--runtime": true, "--security-opt": true, "--shm-size": true,
+	"--stop-signal": true, "--stop-timeout": true, "--storage-opt": true,
+	"--sysctl": true, "--tmpfs": true, "-u": true, "--user": true, "--userns": true,
+	"--uts": true, "--ulimit": true, "--volume-driver": true, "--volumes-from": true,
+}
+
+func ParseParams(input string) (*RunParams, error) {
+	args, err := SplitParams(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &RunParams{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			p.Image = arg
+			p.Cmd = args[i+1:]
+			break
+		}
+		flag, value, hasValue := arg, "", false
+		if idx := strings.Index(arg, "="); idx > 0 && strings.HasPrefix(arg, "--") {
+			flag, value, hasValue = arg[:idx], arg[idx+1:], true
+		}
+		if flag == "-d" || flag == "--detach" {
+			p.Detach = true
+			continue
+		}
+		if boolFlags[flag] {
+			p.Extra = append(p.Extra, arg)
+			continue
+		}
+		if !valueFlags[flag] {
+			return nil, fmt.Errorf("unknown docker run flag %s", flag)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag %s needs a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+		switch flag {
+		case "--name":
+			p.Name = value
+		case "-h", "--hostname":
+			p.Hostname = value
+		case "--restart":
+			p.Restart = value
+		case "-w", "--workdir":
+			p.Workdir = value
+		case "-v", "--volume":
+			p.Volumes = append(p.Volumes, value)
+		case "-p", "--publish":
+			p.Ports = append(p.Ports, value)
+		case "-e", "--env":
+			p.Env = append(p.Env, value)
+		case "--network", "--net":
+			p.Network = value
+		case "--network-alias", "--net-alias":
+			p.NetworkAliases = append(p.NetworkAliases, value)
+		case "--link":
+			p.Links = append(p.Links, value)
+		default:
+			p.Extra = append(p.Extra, flag, value)
+		}
+	}
+	if p.Image == "" {
+		return nil, errors.New("container params have no image")
+	}
+	return p, nil
+}
+
+// SplitParams splits the params the way a POSIX shell would split words,
+// honoring single quotes, double quotes and backslash escapes. Template
+// expressions such as `{{ box_hostname }}` are kept within one word.
+func SplitParams(input string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, quote, escaped := false, rune(0), false
+	for i := 0; i < len(input); i++ {
+		r := rune(input[i])
+		switch {
+		case escaped:
+			word.WriteByte(input[i])
+			escaped = false
+		case strings.HasPrefix(input[i:], "{{"):
+			end := strings.Index(input[i:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated template in params: %s", input)
+			}
+			word.WriteString(input[i : i+end+2])
+			i += end + 1
+			inWord = true
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteByte(input[i])
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(input[i])
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in params: %s", input)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -1,14 +1,23 @@
 package plugins
 
 import (
-	"errors"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/aminjam/hipops/inventory"
 	"github.com/aminjam/hipops/utilities"
 )
 
+// HASH_LABEL is the container label plugins use to record Container.Hash.
+const HASH_LABEL = "io.hipops.hash"
+
 type Plugin interface {
 	DefaultPlay() string
 	Mask(string) string
@@ -16,21 +25,56 @@ type Plugin interface {
 	Run(*Action) error
 	ValidateParams(arg ...string) error
 }
+
+// Failer is implemented by the plugins whose DefaultPlay, Mask or Unmask
+// can fail. Err is the first of those failures, for the caller to report.
+type Failer interface {
+	Err() error
+}
+
+// Passthrough parses a scenario without a target plugin. It keeps
+// `{{ box_x }}` references as they were written.
+var Passthrough Plugin = passthrough{}
+
+type passthrough struct{}
+
+var boxMask = regexp.MustCompile(`{{(\s*)box_`)
+var boxUnmask = regexp.MustCompile(`@BOX\.([^.]*)\.`)
+
+func (passthrough) DefaultPlay() string { return "" }
+func (passthrough) Mask(input string) string {
+	return boxMask.ReplaceAllString(input, "@BOX.${1}.")
+}
+func (passthrough) Unmask(input string) string {
+	return boxUnmask.ReplaceAllString(input, "{{${1}box_")
+}
+func (passthrough) Run(*Action) error              { return nil }
+func (passthrough) ValidateParams(...string) error { return nil }
+
 type Action struct {
 	Dest              string           `json:"dest"`
 	Play              string           `json:"play"`
 	Inventory         string           `json:"inventory"`
+	Ports             []int            `json:"ports,omitempty"`
 	PythonInterpreter string           `json:"ansible_python_interpreter,omitempty"`
 	Repository        *Repository      `json:"repository,omitempty"`
 	Files             []*Customization `json:"files,omitempty"`
 	Containers        []*Container     `json:"containers,omitempty"`
+	Registry          *Registry        `json:"registry,omitempty"`
+	Networks          []*Network       `json:"networks,omitempty"`
+	Volumes           []*Volume        `json:"volumes,omitempty"`
 
-	PrivateKey    string `json:"-"`
-	User          string `json:"-"`
-	InventoryFile string `json:"-"`
-	Name          string `json:"-"`
-	Suffix        string `json:"-"`
-	Debug         int    `json:"-"`
+	PrivateKey    string               `json:"-"`
+	User          string               `json:"-"`
+	InventoryFile string               `json:"-"`
+	Name          string               `json:"-"`
+	Suffix        string               `json:"-"`
+	Debug         int                  `json:"-"`
+	Ansible       *AnsibleOptions      `json:"-"`
+	Result        *Result              `json:"-"`
+	Hosts         *inventory.Inventory `json:"-"`
+	Workspace     *utilities.Workspace `json:"-"`
+	Build         *ImageBuild          `json:"-"`
 }
 
 func (a *Action) BaseDuplicate() *Action {
@@ -38,6 +82,8 @@ func (a *Action) BaseDuplicate() *Action {
 	dup.Suffix = a.Suffix
 	dup.User = a.User
 	dup.PythonInterpreter = a.PythonInterpreter
+	dup.Hosts = a.Hosts
+	dup.Workspace = a.Workspace
 	return dup
 }
 
@@ -57,36 +103,156 @@ type Repository struct {
 	SshUrl string `json:"sshUrl"`
 	SshKey string `json:"sshKey"`
 	Folder string `json:"folder"`
+
+	// Url is an https://, ssh:// or git@host:path URL; sshUrl is the older
+	// host/path.git form cloned over ssh://git@
+	Url string `json:"url,omitempty"`
+	// Ref is a branch, tag or commit to check out, Branch when empty
+	Ref        string `json:"ref,omitempty"`
+	Depth      int    `json:"depth,omitempty"`
+	Submodules bool   `json:"submodules,omitempty"`
+	// DeployKey is the repository's own SSH key, used instead of -git-key
+	DeployKey string `json:"deployKey,omitempty"`
+
+	// Mode "ship" checks the repository out where hipops runs, runs Build
+	// in it and ships the result as the tarball Archive instead of cloning
+	// on the hosts
+	Mode    string `json:"mode,omitempty"`
+	Build   string `json:"build,omitempty"`
+	Archive string `json:"archive,omitempty"`
 }
 
-func (r *Repository) Configure() (err error) {
-	if strings.Contains(r.SshUrl, "@") || !strings.Contains(r.SshUrl, ".git") {
-		err = errors.New(utilities.INVALID_REPOSITORY)
+const (
+	CLONE_REPOSITORY_MODE = "clone"
+	SHIP_REPOSITORY_MODE  = "ship"
+)
+
+var (
+	scpUrl  = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/].*$`)
+	httpUrl = regexp.MustCompile(`^https://[^/\s]+/\S+$`)
+	sshUrl  = regexp.MustCompile(`^ssh://([^@/\s]+@)?[^/\s]+/\S+$`)
+	hostUrl = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?/\S+\.git$`)
+	commit  = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	badRef  = regexp.MustCompile(`\.\.|@\{|[\x00-\x20~^:?*\[\\\x7f]|^[-/.]|[/.]$|\.lock$|//`)
+)
+
+// Configure resolves Url and Ref and explains what is wrong with them.
+func (r *Repository) Configure() error {
+	if r.Url == "" {
+		switch {
+		case r.SshUrl == "":
+			return fmt.Errorf("%s url or sshUrl is required", utilities.INVALID_REPOSITORY)
+		case hostUrl.MatchString(r.SshUrl):
+			r.Url = "ssh://git@" + r.SshUrl
+		default:
+			r.Url = r.SshUrl
+		}
+	}
+	switch {
+	case strings.HasPrefix(r.Url, "http://"):
+		return fmt.Errorf("%s %s is not encrypted, use https://", utilities.INVALID_REPOSITORY, r.Url)
+	case !httpUrl.MatchString(r.Url) && !sshUrl.MatchString(r.Url) && !scpUrl.MatchString(r.Url):
+		return fmt.Errorf("%s %s is not an https://, ssh:// or user@host:path URL", utilities.INVALID_REPOSITORY, r.Url)
 	}
 	if r.Branch == "" {
 		r.Branch = utilities.DEFAULT_APP_BRANCH
 	}
-	return
+	if r.Ref == "" {
+		r.Ref = r.Branch
+	}
+	if badRef.MatchString(r.Ref) {
+		return fmt.Errorf("%s ref %q is not a valid branch, tag or commit", utilities.INVALID_REPOSITORY, r.Ref)
+	}
+	if r.Depth < 0 {
+		return fmt.Errorf("%s depth %d is negative", utilities.INVALID_REPOSITORY, r.Depth)
+	}
+	switch r.Mode {
+	case "", CLONE_REPOSITORY_MODE:
+		if r.Build != "" {
+			return fmt.Errorf("%s build needs mode %q", utilities.INVALID_REPOSITORY, SHIP_REPOSITORY_MODE)
+		}
+	case SHIP_REPOSITORY_MODE:
+	default:
+		return fmt.Errorf("%s mode %q is not %q or %q", utilities.INVALID_REPOSITORY, r.Mode, CLONE_REPOSITORY_MODE, SHIP_REPOSITORY_MODE)
+	}
+	if r.DeployKey != "" {
+		if !r.IsSsh() {
+			return fmt.Errorf("%s deployKey needs an SSH URL, %s is https", utilities.INVALID_REPOSITORY, r.Url)
+		}
+		r.SshKey = r.DeployKey
+	}
+	return nil
+}
+
+// CloneUrl is the URL git clones the repository from.
+func (r *Repository) CloneUrl() string {
+	return r.Url
+}
+
+// IsSsh tells whether the repository is cloned over SSH and needs a key.
+func (r *Repository) IsSsh() bool {
+	return !strings.HasPrefix(r.Url, "https://")
+}
+
+// Shipped tells whether the hosts receive Archive instead of cloning.
+func (r *Repository) Shipped() bool {
+	return r.Mode == SHIP_REPOSITORY_MODE
+}
+
+// IsCommit tells whether Ref names a commit rather than a branch or tag.
+func (r *Repository) IsCommit() bool {
+	return commit.MatchString(r.Ref)
+}
+
+// Path is where the repository is checked out under the app dest.
+func (r *Repository) Path(dest string) string {
+	return path.Join(dest, r.Folder)
 }
 
 type Customization struct {
 	Src        string `json:"src"`
 	Dest       string `json:"dest"`
 	DestFolder string `json:"destFolder"`
-	Mode       int    `json:"mode"`
+	Mode       Mode   `json:"mode"`
+	Owner      string `json:"owner,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Secret     bool   `json:"secret,omitempty"`
+	// Template renders Src with the scenario and its app before shipping it
+	Template bool `json:"template,omitempty"`
+	// Exclude skips matching files of a directory or glob Src
+	Exclude []string `json:"exclude,omitempty"`
+
+	// remote srcs only; Timeout is in seconds and MaxSize in bytes, and
+	// Retries is the default unless set, so 0 turns retries off
+	Sha256  string `json:"sha256,omitempty"`
+	Timeout int    `json:"timeout,omitempty"`
+	Retries *int   `json:"retries,omitempty"`
+	MaxSize int64  `json:"maxSize,omitempty"`
 }
 
-func (c *Customization) Configure(suffix string, appDest string) (err error) {
+// Configure downloads a remote Src and resolves a relative one against
+// baseDir, or marks it with @BASEDIR when baseDir is unknown.
+func (c *Customization) Configure(ws *utilities.Workspace, baseDir, appDest string) (err error) {
 	if strings.HasPrefix(c.Src, "http") {
-		c.Src, err = utilities.DownloadFile(c.Src, suffix)
+		c.Src, err = ws.Download(&utilities.Download{
+			Url:     c.Src,
+			Sha256:  c.Sha256,
+			Timeout: time.Duration(c.Timeout) * time.Second,
+			Retries: c.Retries,
+			MaxSize: c.MaxSize,
+		})
 		if err != nil {
 			return
 		}
 	} else if !strings.HasPrefix(c.Src, "/") {
-		c.Src = "@BASEDIR/" + c.Src
+		if baseDir == "" {
+			c.Src = "@BASEDIR/" + c.Src
+		} else if c.Src, err = filepath.Abs(filepath.Join(baseDir, c.Src)); err != nil {
+			return
+		}
 	}
 	if c.Mode == 0 {
-		c.Mode = 400
+		c.Mode = 0400
 	}
 	if !strings.HasPrefix(c.Dest, "~") || !strings.HasPrefix(c.Dest, "/") {
 		c.Dest = fmt.Sprintf("%s/%s", appDest, c.Dest)
@@ -95,10 +261,23 @@ func (c *Customization) Configure(suffix string, appDest string) (err error) {
 	return nil
 }
 
+// FileMode is Mode as permissions, 0400 when unset.
+func (c *Customization) FileMode() os.FileMode {
+	if c.Mode == 0 {
+		return 0400
+	}
+	return os.FileMode(c.Mode)
+}
+
 type Container struct {
 	Params string `json:"params"`
 	Name   string `json:"name"`
 	State  string `json:"state"`
+	// Connect are the networks the container joins besides the one in
+	// its params
+	Connect []*Network `json:"connect,omitempty"`
+	// Backup are the volumes to snapshot before the container is replaced
+	Backup []*Volume `json:"backup,omitempty"`
 }
 
 func (c *Container) Configure() {
@@ -111,10 +290,19 @@ func (c *Container) Configure() {
 	}
 }
 
+// Hash identifies the container's configuration, so plugins can tell
+// whether an existing container has to be replaced.
+func (c *Container) Hash() string {
+	sum := sha1.Sum([]byte(c.Params))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 func (a *Container) BaseDuplicate() *Container {
 	dup := &Container{}
 	dup.Params = a.Params
 	dup.Name = a.Name
 	dup.State = a.State
+	dup.Connect = a.Connect
+	dup.Backup = a.Backup
 	return dup
 }
@@ -0,0 +1,109 @@
+package plugins
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+// Secret is a value that is passed to the plugins but never printed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "********"
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// Registry holds the credentials the hosts log in with before pulling an
+// app's image. The password is read from the environment variable
+// PasswordEnv or from PasswordFile, never from the scenario itself.
+type Registry struct {
+	Server       string `json:"server"`
+	Username     string `json:"username"`
+	PasswordEnv  string `json:"passwordEnv,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+	Password     Secret `json:"password,omitempty"`
+}
+
+// Configure explains what is missing. The password is only read by
+// Resolve, so commands that do not log in need no credentials.
+func (r *Registry) Configure() error {
+	switch {
+	case r.Server == "" || r.Username == "":
+		return fmt.Errorf("%s server and username are required", utilities.INVALID_REGISTRY)
+	case r.Password != "":
+		return fmt.Errorf("%s %s: password must come from passwordEnv or passwordFile", utilities.INVALID_REGISTRY, r.Server)
+	case (r.PasswordEnv == "") == (r.PasswordFile == ""):
+		return fmt.Errorf("%s %s: one of passwordEnv or passwordFile is required", utilities.INVALID_REGISTRY, r.Server)
+	}
+	return nil
+}
+
+// Resolve reads the password from PasswordEnv or PasswordFile, once.
+func (r *Registry) Resolve() error {
+	switch {
+	case r.Password != "":
+	case r.PasswordEnv != "":
+		r.Password = Secret(os.Getenv(r.PasswordEnv))
+		if r.Password == "" {
+			return fmt.Errorf("%s %s: $%s is not set", utilities.INVALID_REGISTRY, r.Server, r.PasswordEnv)
+		}
+	default:
+		content, err := ioutil.ReadFile(utilities.ExpandPath(r.PasswordFile))
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", utilities.INVALID_REGISTRY, r.Server, err)
+		}
+		r.Password = Secret(strings.TrimRight(string(content), "\r\n"))
+	}
+	return nil
+}
+
+// Serves tells whether image is pulled from the registry.
+func (r *Registry) Serves(image string) bool {
+	server := strings.TrimPrefix(strings.TrimPrefix(r.Server, "https://"), "http://")
+	server = strings.TrimSuffix(server, "/")
+	registry := utilities.ParseImage(image).Registry
+	if registry == utilities.DOCKER_HUB_REGISTRY {
+		return server == "docker.io" || server == "index.docker.io" || server == registry
+	}
+	return server == registry
+}
+
+// PasswordVar is the environment variable a generated script reads the
+// password from: PasswordEnv, or HIPOPS_REGISTRY_PASSWORD for a file.
+func (r *Registry) PasswordVar() string {
+	if r.PasswordEnv != "" {
+		return r.PasswordEnv
+	}
+	return "HIPOPS_REGISTRY_PASSWORD"
+}
+
+// Auth is the X-Registry-Auth header of the Docker Engine API.
+func (r *Registry) Auth() string {
+	content, _ := json.Marshal(map[string]string{
+		"username":      r.Username,
+		"password":      string(r.Password),
+		"serveraddress": r.Server,
+	})
+	return base64.URLEncoding.EncodeToString(content)
+}
+
+// Login is how `hipops lock` authenticates to the registry, nil for no
+// registry.
+func (r *Registry) Login() *utilities.RegistryLogin {
+	if r == nil {
+		return nil
+	}
+	return &utilities.RegistryLogin{Username: r.Username, Password: string(r.Password)}
+}
@@ -0,0 +1,41 @@
+package plugins
+
+const (
+	STATUS_OK          = "ok"
+	STATUS_CHANGED     = "changed"
+	STATUS_FAILED      = "failed"
+	STATUS_UNREACHABLE = "unreachable"
+	STATUS_SKIPPED     = "skipped"
+)
+
+// Result is the per-host outcome of running an action, for plugins that
+// can report one.
+type Result struct {
+	Hosts []*HostResult `json:"hosts"`
+}
+
+type HostResult struct {
+	Name   string        `json:"name"`
+	Status string        `json:"status"`
+	Tasks  []*TaskResult `json:"tasks,omitempty"`
+}
+
+type TaskResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// Failed lists the hosts that failed or were unreachable.
+func (r *Result) Failed() []string {
+	failed := []string{}
+	if r == nil {
+		return failed
+	}
+	for _, h := range r.Hosts {
+		if h.Status == STATUS_FAILED || h.Status == STATUS_UNREACHABLE {
+			failed = append(failed, h.Name)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,125 @@
+package script
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/plugins/shell"
+)
+
+var Instance plugins.Plugin
+
+// instance keeps every action it has run so far, so each Run rewrites the
+// complete script of the action's inventory group.
+type instance struct {
+	dir     string
+	actions map[string][]*plugins.Action
+}
+
+func init() {
+	Instance = &instance{}
+}
+func (i *instance) DefaultPlay() string {
+	return "script"
+}
+func (i *instance) Mask(input string) string {
+	return input
+}
+func (i *instance) Unmask(input string) string {
+	return input
+}
+func (i *instance) ValidateParams(args ...string) error {
+	if len(args) == 0 || args[0] == "" {
+		return errors.New("--script-dir is required for script plugin")
+	}
+	if err := os.MkdirAll(args[0], 0755); err != nil {
+		return err
+	}
+	i.dir = args[0]
+	i.actions = map[string][]*plugins.Action{}
+	return nil
+}
+func (i *instance) Run(a *plugins.Action) error {
+	if i.actions == nil {
+		return errors.New("script plugin is not configured")
+	}
+	i.actions[a.Inventory] = append(i.actions[a.Inventory], a)
+	content, err := Render(a.Inventory, i.actions[a.Inventory])
+	if err != nil {
+		return err
+	}
+	fileName := filepath.Join(i.dir, FileName(a.Inventory))
+	fmt.Println("Writing...", fileName)
+	return ioutil.WriteFile(fileName, content, 0755)
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func FileName(group string) string {
+	return unsafeChars.ReplaceAllString(group, "_") + ".sh"
+}
+
+// Render writes the actions of an inventory group as one bash script. The
+// output only depends on the actions, so it can be committed and diffed.
+func Render(group string, actions []*plugins.Action) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "#!/usr/bin/env bash\n# Generated by hipops for inventory group %s.\nset -euo pipefail\n", group)
+	for _, a := range actions {
+		fmt.Fprintf(buf, "\n# %s\n%s\n", a.Name, shell.Mkdir(a.Dest))
+		if r := a.Repository; r != nil && r.Shipped() {
+			content, err := ioutil.ReadFile(r.Archive)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(buf, "base64 -d <<'HIPOPS_EOF' | %s\n", shell.Unpack(r, a.Dest))
+			writeBase64(buf, content)
+		} else if r != nil {
+			fmt.Fprintln(buf, shell.Repository(r, a.Dest, ""))
+		}
+		for _, f := range a.Files {
+			content, err := ioutil.ReadFile(f.Src)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(buf, "%s\nbase64 -d > %s <<'HIPOPS_EOF'\n", shell.Mkdir(f.DestFolder), shell.Quote(f.Dest))
+			writeBase64(buf, content)
+			fmt.Fprintln(buf, shell.Permissions(f))
+		}
+		// facts are read on the host when the script runs
+		containers := plugins.ResolveContainers(a.Containers, func(f *plugins.Fact) string {
+			return fmt.Sprintf(`"$(%s)"`, f.Shell)
+		})
+		for _, n := range a.Networks {
+			fmt.Fprintln(buf, shell.Network(n))
+		}
+		// the password is read on the host, the script never holds it
+		if r := a.Registry; r != nil {
+			fmt.Fprintf(buf, "printf '%%s\\n' \"${%s:?}\" | %s\n", r.PasswordVar(), shell.Login(r))
+		}
+		for _, c := range containers {
+			cmd, err := shell.Container(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", c.Name, err)
+			}
+			fmt.Fprintln(buf, cmd)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes content as base64 lines closing the HIPOPS_EOF heredoc.
+func writeBase64(buf *bytes.Buffer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		fmt.Fprintln(buf, encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(buf, "%s\nHIPOPS_EOF\n", encoded)
+}
@@ -0,0 +1,150 @@
+package script
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/plugins/shell"
+	"github.com/aminjam/hipops/utilities"
+)
+
+func TestScriptPlugin_implements(t *testing.T) {
+	var _ plugins.Plugin = &instance{}
+}
+
+func TestScriptPlugin_run(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-script")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "nginx.conf")
+	ioutil.WriteFile(src, []byte("server {}"), 0600)
+
+	actions := []*plugins.Action{{
+		Name:      "0-db-mongo",
+		Dest:      "/data/0-test/db/0-db-mongo",
+		Inventory: "tag_App-Role_DEMO",
+		Containers: []*plugins.Container{{
+			Name: "0-db-mongo", State: utilities.DEFAULT_APP_STATE,
+			Params: "--name 0-db-mongo -e MONGO_OPTIONS='--smallfiles' -d aminjam/mongodb:latest /run.sh",
+		}},
+	}, {
+		Name:       "backend-api",
+		Dest:       "/data/0-test/nodejs/backend-api",
+		Inventory:  "tag_App-Role_DEMO",
+		Repository: &plugins.Repository{Branch: "master", Ref: "master", Url: "ssh://git@github.com/aminjam/backend.git"},
+		Files: []*plugins.Customization{{
+			Src: src, Dest: "/data/0-test/nodejs/backend-api/nginx.conf",
+			DestFolder: "/data/0-test/nodejs/backend-api", Mode: 0400,
+		}},
+		Containers: []*plugins.Container{{
+			Name: "backend-api", State: utilities.REDEPLOY_APP_STATE,
+			Params: "--name backend-api -h @HOST(hostname) -d aminjam/nodejs:latest",
+		}},
+	}}
+
+	i := &instance{}
+	spec.Expect(i.ValidateParams(dir)).ToEqual(nil)
+	for _, a := range actions {
+		spec.Expect(i.Run(a)).ToEqual(nil)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "tag_App-Role_DEMO.sh"))
+	spec.Expect(err).ToEqual(nil)
+	script := utilities.Spec(t).ExpectString(string(content))
+	script.ToContain("set -euo pipefail")
+	script.ToContain("# 0-db-mongo\nmkdir -p '/data/0-test/db/0-db-mongo'")
+	script.ToContain("docker run --label io.hipops.hash=")
+	script.ToContain("-e MONGO_OPTIONS='--smallfiles' -d aminjam/mongodb:latest /run.sh")
+	script.ToContain("git clone --branch 'master' 'ssh://git@github.com/aminjam/backend.git'")
+	script.ToContain("git fetch origin 'master' && git checkout -f FETCH_HEAD")
+	script.ToContain(`--name backend-api -h "$(hostname -s)" -d aminjam/nodejs:latest`)
+	script.ToContain("base64 -d > '/data/0-test/nodejs/backend-api/nginx.conf' <<'HIPOPS_EOF'\nc2VydmVyIHt9\nHIPOPS_EOF\nchmod 0400")
+
+	again, _ := Render("tag_App-Role_DEMO", actions)
+	spec.Expect(string(again)).ToEqual(string(content))
+}
+
+func TestScriptPlugin_repositoryRef(t *testing.T) {
+	spec := utilities.Spec(t)
+	r := &plugins.Repository{Url: "https://github.com/aminjam/backend.git", Ref: "3f2a9c1", Depth: 1, Submodules: true}
+	cmd := utilities.Spec(t).ExpectString(shell.Repository(r, "/data/app", ""))
+	cmd.ToContain("git clone --depth 1 'https://github.com/aminjam/backend.git' '/data/app'")
+	cmd.ToContain("git fetch --depth 1 origin '3f2a9c1' && git checkout -f FETCH_HEAD")
+	cmd.ToContain("git submodule update --init --recursive --depth 1")
+	spec.Expect(r.IsCommit()).ToEqual(true)
+}
+
+func TestScriptPlugin_registry(t *testing.T) {
+	spec := utilities.Spec(t)
+	registry := &plugins.Registry{Server: "registry.example.com", Username: "deploy", PasswordEnv: "REGISTRY_PASSWORD", Password: "s3cret"}
+	container := &plugins.Container{Name: "api", State: utilities.DEFAULT_APP_STATE, Params: "--name api -d registry.example.com/team/api:v1"}
+	actions := []*plugins.Action{{Name: "api", Dest: "/data/api", Containers: []*plugins.Container{container}, Registry: registry}}
+	content, err := Render("web", actions)
+	spec.Expect(err).ToEqual(nil)
+	spec.ExpectString(string(content)).ToContain(`printf '%s\n' "${REGISTRY_PASSWORD:?}" | docker login --username 'deploy' --password-stdin 'registry.example.com' >/dev/null` + "\nif [")
+	spec.Expect(strings.Contains(string(content), "s3cret")).ToEqual(false)
+}
+
+func TestScriptPlugin_networks(t *testing.T) {
+	spec := utilities.Spec(t)
+	backend := &plugins.Network{Name: "backend", Aliases: []string{"mongo"}}
+	frontend := &plugins.Network{Name: "frontend", Driver: "overlay", Aliases: []string{"api"}}
+	container := &plugins.Container{Name: "api", State: utilities.DEFAULT_APP_STATE, Params: "--name api -d aminjam/nodejs:latest"}
+	spec.Expect(container.Attach([]*plugins.Network{backend, frontend})).ToEqual(nil)
+	actions := []*plugins.Action{{Name: "api", Dest: "/data/api", Containers: []*plugins.Container{container}, Networks: []*plugins.Network{backend, frontend}}}
+	content, err := Render("web", actions)
+	spec.Expect(err).ToEqual(nil)
+	script := spec.ExpectString(string(content))
+	script.ToContain("docker network inspect 'backend' >/dev/null 2>&1 || docker network create 'backend' >/dev/null\n")
+	script.ToContain("docker network inspect 'frontend' >/dev/null 2>&1 || docker network create --driver 'overlay' 'frontend' >/dev/null\n")
+	script.ToContain("docker run --label io.hipops.hash=")
+	script.ToContain(" --network backend --network-alias mongo --name api -d aminjam/nodejs:latest\n  docker network connect --alias 'api' 'frontend' 'api'\nfi")
+}
+
+func TestScriptPlugin_volumes(t *testing.T) {
+	spec := utilities.Spec(t)
+	data := &plugins.Volume{Name: "data", Path: "/data/mongo/db", Target: "/data/db", BackupBeforeDeploy: true, SnapshotDir: "/data/snapshots/mongo"}
+	logs := &plugins.Volume{Name: "logs", Volume: "mongo_logs", Target: "/var/log/mongodb", BackupBeforeDeploy: true, SnapshotDir: "/data/snapshots/mongo"}
+	container := &plugins.Container{Name: "mongo", State: utilities.DEFAULT_APP_STATE, Params: "--name mongo -d aminjam/mongodb:latest"}
+	spec.Expect(container.Mount([]*plugins.Volume{data, logs})).ToEqual(nil)
+	content, err := Render("db", []*plugins.Action{{Name: "mongo", Dest: "/data/mongo", Containers: []*plugins.Container{container}}})
+	spec.Expect(err).ToEqual(nil)
+	script := spec.ExpectString(string(content))
+	script.ToContain(`  docker pull 'aminjam/mongodb:latest' || exit 1
+  if docker inspect 'mongo' >/dev/null 2>&1; then
+    mkdir -p '/data/snapshots/mongo' && tar -czf '/data/snapshots/mongo'/'data'-"$(date -u +%Y%m%dT%H%M%SZ)".tar.gz -C '/data/mongo/db' . &&
+    mkdir -p '/data/snapshots/mongo' && docker run --rm -v 'mongo_logs':/volume:ro -v '/data/snapshots/mongo':/snapshots busybox tar -czf /snapshots/'logs'-"$(date -u +%Y%m%dT%H%M%SZ)".tar.gz -C /volume . || exit 1
+  fi
+  docker rm -f 'mongo'`)
+	script.ToContain("docker run --label io.hipops.hash=" + container.Hash() + " -v /data/mongo/db:/data/db -v mongo_logs:/var/log/mongodb --name mongo")
+
+	restore := spec.ExpectString(shell.Restore(data, "", []string{"mongo"}))
+	restore.ToContain("snapshot=$(ls -1 '/data/snapshots/mongo'/'data-'*.tar.gz 2>/dev/null | tail -n 1)")
+	restore.ToContain(`docker stop 'mongo' >/dev/null 2>&1 || true
+mkdir -p '/data/mongo/db' && find '/data/mongo/db' -mindepth 1 -delete && tar -xzf "$snapshot" -C '/data/mongo/db'
+docker start 'mongo'`)
+}
+
+func TestScriptPlugin_failedSnapshot(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-script")
+	defer os.RemoveAll(dir)
+	// the fake docker knows the old container and fails to snapshot it
+	ioutil.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\necho \"$*\" >> "+dir+"/calls\n[ \"$1\" != run ]\n"), 0755)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	logs := &plugins.Volume{Name: "logs", Volume: "mongo_logs", Target: "/var/log/mongodb", BackupBeforeDeploy: true, SnapshotDir: filepath.Join(dir, "snapshots")}
+	container := &plugins.Container{Name: "mongo", State: utilities.DEFAULT_APP_STATE, Params: "--name mongo -d aminjam/mongodb:latest"}
+	spec.Expect(container.Mount([]*plugins.Volume{logs})).ToEqual(nil)
+	cmd, err := shell.Container(container)
+	spec.Expect(err).ToEqual(nil)
+	spec.Expect(exec.Command("sh", "-c", cmd).Run() != nil).ToEqual(true)
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	spec.ExpectString(string(calls)).ToContain("run --rm -v mongo_logs:/volume:ro")
+	spec.Expect(strings.Contains(string(calls), "rm -f")).ToEqual(false)
+}
@@ -0,0 +1,170 @@
+// Package shell renders actions as POSIX shell commands for the plugins
+// that drive hosts without Ansible.
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+)
+
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func Mkdir(dir string) string {
+	return fmt.Sprintf("mkdir -p %s", Quote(dir))
+}
+
+// WriteFile copies stdin into the customization's dest with its mode and
+// owner.
+func WriteFile(f *plugins.Customization) string {
+	return fmt.Sprintf("mkdir -p %s && cat > %s && %s",
+		Quote(f.DestFolder), Quote(f.Dest), Permissions(f))
+}
+
+// Permissions sets the mode and, when given, the owner of the
+// customization's dest.
+func Permissions(f *plugins.Customization) string {
+	cmd := fmt.Sprintf("chmod %04o %s", f.FileMode(), Quote(f.Dest))
+	if chown := f.Chown(); chown != "" {
+		cmd += fmt.Sprintf(" && chown %s %s", Quote(chown), Quote(f.Dest))
+	}
+	return cmd
+}
+
+// Repository clones the repository and checks out its ref, or fetches and
+// checks out the ref again when it is already cloned. keyPath is the remote
+// path of the git key and may be empty.
+func Repository(r *plugins.Repository, dest, keyPath string) string {
+	dir := Quote(r.Path(dest))
+	env := ""
+	if keyPath != "" {
+		env = fmt.Sprintf("GIT_SSH_COMMAND=%s ", Quote(fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no", keyPath)))
+	}
+	depth := ""
+	if r.Depth > 0 {
+		depth = fmt.Sprintf("--depth %d ", r.Depth)
+	}
+	// commits cannot be cloned by name, so they are fetched after the clone
+	branch := ""
+	if !r.IsCommit() {
+		branch = fmt.Sprintf("--branch %s ", Quote(r.Ref))
+	}
+	cmd := fmt.Sprintf(`if [ ! -d %[1]s/.git ]; then
+  %[2]sgit clone %[3]s%[4]s%[5]s %[1]s
+fi
+(cd %[1]s && %[2]sgit fetch %[3]sorigin %[6]s && git checkout -f FETCH_HEAD)`, dir, env, depth, branch, Quote(r.CloneUrl()), Quote(r.Ref))
+	if r.Submodules {
+		cmd += fmt.Sprintf("\n(cd %s && %sgit submodule update --init --recursive %s)", dir, env, strings.TrimSpace(depth))
+	}
+	return cmd
+}
+
+// Unpack extracts the shipped repository tarball from stdin into its path.
+func Unpack(r *plugins.Repository, dest string) string {
+	dir := Quote(r.Path(dest))
+	return fmt.Sprintf("mkdir -p %s && tar -xzf - -C %s", dir, dir)
+}
+
+// Login logs in to the registry with the password read from stdin, so it
+// never shows up in the command line.
+func Login(r *plugins.Registry) string {
+	return fmt.Sprintf("docker login --username %s --password-stdin %s >/dev/null", Quote(r.Username), Quote(r.Server))
+}
+
+// Network creates the network unless it exists.
+func Network(n *plugins.Network) string {
+	create := "docker network create"
+	if n.Driver != "" {
+		create += " --driver " + Quote(n.Driver)
+	}
+	return fmt.Sprintf("docker network inspect %[1]s >/dev/null 2>&1 || %[2]s %[1]s >/dev/null", Quote(n.Name), create)
+}
+
+// SNAPSHOT_IMAGE is the image that reads and writes named volumes.
+const SNAPSHOT_IMAGE = "busybox"
+
+// Snapshot writes the volume as a timestamped tarball into its snapshot
+// directory on the host.
+func Snapshot(v *plugins.Volume) string {
+	dir := Quote(v.SnapshotDir)
+	file := fmt.Sprintf(`%s-"$(date -u +%%Y%%m%%dT%%H%%M%%SZ)".tar.gz`, Quote(v.Name))
+	if v.Path != "" {
+		return fmt.Sprintf("mkdir -p %s && tar -czf %s/%s -C %s .", dir, dir, file, Quote(v.Path))
+	}
+	return fmt.Sprintf("mkdir -p %s && docker run --rm -v %s:/volume:ro -v %s:/snapshots %s tar -czf /snapshots/%s -C /volume .",
+		dir, Quote(v.Source()), dir, SNAPSHOT_IMAGE, file)
+}
+
+// Restore stops the containers, replaces the volume's content with the
+// snapshot, the latest one when it is empty, and starts them again.
+func Restore(v *plugins.Volume, snapshot string, containers []string) string {
+	dir := Quote(v.SnapshotDir)
+	find := fmt.Sprintf("snapshot=$(ls -1 %s/%s*.tar.gz 2>/dev/null | tail -n 1)", dir, Quote(v.SnapshotPrefix()))
+	if snapshot != "" {
+		find = fmt.Sprintf("snapshot=%s/%s", dir, Quote(snapshot))
+	}
+	restore := fmt.Sprintf(`mkdir -p %[1]s && find %[1]s -mindepth 1 -delete && tar -xzf "$snapshot" -C %[1]s`, Quote(v.Path))
+	if v.Path == "" {
+		restore = fmt.Sprintf(`docker run --rm -v %s:/volume -v %s:/snapshots:ro %s sh -c "find /volume -mindepth 1 -delete && tar -xzf /snapshots/$(basename "$snapshot") -C /volume"`,
+			Quote(v.Source()), dir, SNAPSHOT_IMAGE)
+	}
+	names := make([]string, len(containers))
+	for i, c := range containers {
+		names[i] = Quote(c)
+	}
+	return fmt.Sprintf(`set -e
+%s
+[ -f "$snapshot" ] || { echo "no snapshot of %s in %s" >&2; exit 1; }
+docker stop %s >/dev/null 2>&1 || true
+%s
+docker start %s >/dev/null
+echo "restored $snapshot"`, find, v.Name, v.SnapshotDir, strings.Join(names, " "), restore, strings.Join(names, " "))
+}
+
+// Container brings the container to its state. A running container is kept
+// when its hash label matches; otherwise it is removed and run again.
+func Container(c *plugins.Container) (string, error) {
+	name := Quote(c.Name)
+	switch c.State {
+	case utilities.ABSENT_APP_STATE:
+		return fmt.Sprintf("docker rm -f %s >/dev/null 2>&1 || true", name), nil
+	case utilities.STOPPED_APP_STATE:
+		return fmt.Sprintf("docker stop %s >/dev/null 2>&1 || true", name), nil
+	}
+	params, err := plugins.ParseParams(c.Params)
+	if err != nil {
+		return "", err
+	}
+	backup := ""
+	if len(c.Backup) != 0 {
+		snapshots := []string{}
+		for _, v := range c.Backup {
+			snapshots = append(snapshots, Snapshot(v))
+		}
+		// a failed snapshot stops the deploy before the old container goes
+		backup = fmt.Sprintf("if docker inspect %s >/dev/null 2>&1; then\n    %s || exit 1\n  fi\n  ", name, strings.Join(snapshots, " &&\n    "))
+	}
+	// the old container keeps running when the new image cannot be pulled
+	run := fmt.Sprintf(`docker pull %[2]s || exit 1
+  %[6]sdocker rm -f %[1]s >/dev/null 2>&1 || true
+  docker run --label %[3]s=%[4]s %[5]s`, name, Quote(params.Image), plugins.HASH_LABEL, c.Hash(), c.Params, backup)
+	for _, n := range c.Connect {
+		connect := "docker network connect"
+		for _, alias := range n.Aliases {
+			connect += " --alias " + Quote(alias)
+		}
+		run += fmt.Sprintf("\n  %s %s %s", connect, Quote(n.Name), name)
+	}
+	if c.State == utilities.REDEPLOY_APP_STATE {
+		return fmt.Sprintf("{\n  %s\n}", run), nil
+	}
+	return fmt.Sprintf(`if [ "$(docker inspect -f '{{index .Config.Labels "%[1]s"}}' %[2]s 2>/dev/null)" = %[3]s ]; then
+  docker start %[2]s >/dev/null
+else
+  %[4]s
+fi`, plugins.HASH_LABEL, name, Quote(c.Hash()), run), nil
+}
@@ -0,0 +1,250 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aminjam/hipops/inventory"
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/plugins/shell"
+	"github.com/aminjam/hipops/utilities"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var Instance plugins.Plugin
+
+type instance struct {
+	inventory *inventory.Inventory
+	invErr    error
+	auth      []gossh.AuthMethod
+	hostKey   gossh.HostKeyCallback
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+func init() {
+	Instance = &instance{stdout: os.Stdout, stderr: os.Stderr}
+}
+func (i *instance) DefaultPlay() string {
+	return "ssh"
+}
+func (i *instance) Mask(input string) string {
+	return input
+}
+func (i *instance) Unmask(input string) string {
+	return input
+}
+
+// ValidateParams takes the inventory file, the host private key and the
+// known_hosts file. An empty known_hosts file disables host key checking.
+func (i *instance) ValidateParams(args ...string) error {
+	if len(args) != 3 {
+		return errors.New("ssh plugin expects inventory, private key and known hosts")
+	}
+	if args[1] == "" {
+		return errors.New("--private-key is required for ssh plugin")
+	}
+	key, err := ioutil.ReadFile(utilities.ExpandPath(args[1]))
+	if err != nil {
+		return err
+	}
+	signer, err := gossh.ParsePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	hostKey := gossh.InsecureIgnoreHostKey()
+	if args[2] != "" {
+		if hostKey, err = knownhosts.New(utilities.ExpandPath(args[2])); err != nil {
+			return err
+		}
+	}
+	// scenarios declaring hosts do not need the inventory file
+	i.inventory, i.invErr = inventory.Load(utilities.ExpandPath(args[0]))
+	i.auth = []gossh.AuthMethod{gossh.PublicKeys(signer)}
+	i.hostKey = hostKey
+	return nil
+}
+
+func (i *instance) Run(a *plugins.Action) error {
+	hosts, err := i.hosts(a)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if err := i.runHost(h, a); err != nil {
+			return fmt.Errorf("%s: %s", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// hosts resolves the action's group in the scenario's hosts or -inventory.
+func (i *instance) hosts(a *plugins.Action) ([]*inventory.Host, error) {
+	if i.auth == nil {
+		return nil, errors.New("ssh plugin is not configured")
+	}
+	inv := a.Hosts
+	if inv == nil {
+		if i.invErr != nil {
+			return nil, i.invErr
+		}
+		inv = i.inventory
+	}
+	return inv.Hosts(a.Inventory)
+}
+
+// RestoreVolume restores the snapshot on every host of the action's group.
+func (i *instance) RestoreVolume(a *plugins.Action, v *plugins.Volume, snapshot string) error {
+	hosts, err := i.hosts(a)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(a.Containers))
+	for k, c := range a.Containers {
+		names[k] = c.Name
+	}
+	for _, h := range hosts {
+		client, run, err := i.dial(h, a)
+		if err != nil {
+			return fmt.Errorf("%s: %s", h.Name, err)
+		}
+		err = run(shell.Restore(v, snapshot, names), nil)
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// dial connects to the host and returns a func running a command there
+// with an optional stdin.
+func (i *instance) dial(h *inventory.Host, a *plugins.Action) (*gossh.Client, func(string, []byte) error, error) {
+	user := h.User()
+	if user == "" {
+		user = a.User
+	}
+	client, err := gossh.Dial("tcp", h.Addr(), &gossh.ClientConfig{
+		User:            user,
+		Auth:            i.auth,
+		HostKeyCallback: i.hostKey,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	run := func(cmd string, stdin []byte) error {
+		session, err := client.NewSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		if stdin != nil {
+			session.Stdin = bytes.NewReader(stdin)
+		}
+		session.Stdout = i.stdout
+		session.Stderr = i.stderr
+		if a.Debug > 0 {
+			fmt.Fprintln(i.stdout, "Running...", h.Name, cmd)
+		}
+		return session.Run(cmd)
+	}
+	return client, run, nil
+}
+
+func (i *instance) runHost(h *inventory.Host, a *plugins.Action) error {
+	client, run, err := i.dial(h, a)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = run(shell.Mkdir(a.Dest), nil); err != nil {
+		return err
+	}
+	if a.Repository != nil {
+		if err = i.cloneRepository(a, run); err != nil {
+			return err
+		}
+	}
+	for _, f := range a.Files {
+		content, err := ioutil.ReadFile(f.Src)
+		if err != nil {
+			return err
+		}
+		if err = run(shell.WriteFile(f), content); err != nil {
+			return err
+		}
+	}
+	containers := a.Containers
+	if facts := plugins.FactsOf(containers); len(facts) != 0 {
+		values := map[string]string{}
+		for _, f := range facts {
+			session, err := client.NewSession()
+			if err != nil {
+				return err
+			}
+			out, err := session.Output(f.Shell)
+			session.Close()
+			if err != nil {
+				return fmt.Errorf("host fact %s: %s", f.Name, err)
+			}
+			values[f.Name] = strings.TrimSpace(string(out))
+		}
+		containers = plugins.ResolveContainers(containers, func(f *plugins.Fact) string {
+			return shell.Quote(values[f.Name])
+		})
+	}
+	for _, n := range a.Networks {
+		if err = run(shell.Network(n), nil); err != nil {
+			return fmt.Errorf("network %s: %s", n.Name, err)
+		}
+	}
+	if r := a.Registry; r != nil {
+		if err = run(shell.Login(r), []byte(r.Password)); err != nil {
+			return fmt.Errorf("registry %s: %s", r.Server, err)
+		}
+	}
+	for _, c := range containers {
+		fmt.Fprintln(i.stdout, "Running...", h.Name, c.Name, c.State)
+		cmd, err := shell.Container(c)
+		if err != nil {
+			return err
+		}
+		if err = run(cmd, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneRepository ships the git key for the clone only, into a private
+// temporary file the same command removes when it exits. A shipped
+// repository is unpacked from its archive instead.
+func (i *instance) cloneRepository(a *plugins.Action, run func(string, []byte) error) error {
+	if a.Repository.Shipped() {
+		content, err := ioutil.ReadFile(a.Repository.Archive)
+		if err != nil {
+			return err
+		}
+		return run(shell.Unpack(a.Repository, a.Dest), content)
+	}
+	if a.Repository.SshKey == "" {
+		return run(shell.Repository(a.Repository, a.Dest, ""), nil)
+	}
+	key, err := ioutil.ReadFile(utilities.ExpandPath(a.Repository.SshKey))
+	if err != nil {
+		return err
+	}
+	// git expands the exported variable when it runs GIT_SSH_COMMAND
+	clone := shell.Repository(a.Repository, a.Dest, `"$HIPOPS_GIT_KEY"`)
+	return run(fmt.Sprintf(`HIPOPS_GIT_KEY=$(mktemp) && export HIPOPS_GIT_KEY && trap 'rm -f "$HIPOPS_GIT_KEY"' EXIT HUP INT TERM && cat > "$HIPOPS_GIT_KEY" && {
+%s
+}`, clone), key)
+}
@@ -0,0 +1,202 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aminjam/hipops/plugins"
+	"github.com/aminjam/hipops/utilities"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type execution struct {
+	cmd   string
+	stdin string
+}
+
+// fakeServer accepts any public key and records every exec request with
+// its stdin, answering each with exit status 0. `hostname -s` prints box.
+type fakeServer struct {
+	sync.Mutex
+	listener net.Listener
+	config   *gossh.ServerConfig
+	execs    []execution
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := gossh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &gossh.ServerConfig{
+		PublicKeyCallback: func(gossh.ConnMetadata, gossh.PublicKey) (*gossh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			sc, chans, reqs, err := gossh.NewServerConn(conn, s.config)
+			if err != nil {
+				return
+			}
+			defer sc.Close()
+			go gossh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				if newChannel.ChannelType() != "session" {
+					newChannel.Reject(gossh.UnknownChannelType, "")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go s.session(channel, requests)
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) session(channel gossh.Channel, requests <-chan *gossh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		size := binary.BigEndian.Uint32(req.Payload)
+		cmd := string(req.Payload[4 : 4+size])
+		req.Reply(true, nil)
+		stdin, _ := ioutil.ReadAll(channel)
+		s.Lock()
+		s.execs = append(s.execs, execution{cmd: cmd, stdin: string(stdin)})
+		s.Unlock()
+		if cmd == "hostname -s" {
+			channel.Write([]byte("box\n"))
+		}
+		channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
+
+func TestSshPlugin_implements(t *testing.T) {
+	var _ plugins.Plugin = &instance{}
+}
+
+func TestSshPlugin_run(t *testing.T) {
+	spec := utilities.Spec(t)
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	dir, _ := ioutil.TempDir("", "hipops-ssh")
+	defer os.RemoveAll(dir)
+
+	_, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := gossh.MarshalPrivateKey(clientKey, "")
+	spec.Expect(err).ToEqual(nil)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	inventoryFile := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(inventoryFile, []byte(fmt.Sprintf("[demo]\nbox ansible_host=127.0.0.1 ansible_port=%s\n", port)), 0600)
+
+	src := filepath.Join(dir, "app.env")
+	ioutil.WriteFile(src, []byte("NODE_ENV=development"), 0600)
+
+	i := &instance{stdout: new(bytes.Buffer), stderr: new(bytes.Buffer)}
+	spec.Expect(i.ValidateParams(inventoryFile, keyFile, "")).ToEqual(nil)
+
+	action := &plugins.Action{
+		Dest:       "/data/demo-dev/nodejs/backend-api",
+		Inventory:  "demo",
+		User:       "core",
+		Repository: &plugins.Repository{Branch: "master", Ref: "master", Url: "ssh://git@github.com/aminjam/hipops-SAMOMY-backend.git"},
+		Files: []*plugins.Customization{{
+			Src: src, Dest: "/data/demo-dev/nodejs/backend-api/.env",
+			DestFolder: "/data/demo-dev/nodejs/backend-api", Mode: 0600,
+		}},
+		Containers: []*plugins.Container{{
+			Name:   "backend-api",
+			State:  utilities.DEFAULT_APP_STATE,
+			Params: "--name backend-api -h @HOST(hostname) -e NODE_ENV=development -d aminjam/nodejs:latest /run.sh",
+		}},
+	}
+	spec.Expect(i.Run(action)).ToEqual(nil)
+
+	server.Lock()
+	defer server.Unlock()
+	spec.Expect(len(server.execs)).ToEqual(5)
+	spec.Expect(server.execs[0].cmd).ToEqual("mkdir -p '/data/demo-dev/nodejs/backend-api'")
+	spec.ExpectString(server.execs[1].cmd).ToContain("git clone --branch 'master' 'ssh://git@github.com/aminjam/hipops-SAMOMY-backend.git'")
+	spec.ExpectString(server.execs[2].cmd).ToContain("chmod 0600 '/data/demo-dev/nodejs/backend-api/.env'")
+	spec.Expect(server.execs[2].stdin).ToEqual("NODE_ENV=development")
+	spec.Expect(server.execs[3].cmd).ToEqual("hostname -s")
+	spec.ExpectString(server.execs[4].cmd).ToContain("docker run --label io.hipops.hash=")
+	spec.ExpectString(server.execs[4].cmd).ToContain("--name backend-api -h 'box' -e")
+	spec.Expect(strings.Contains(server.execs[4].cmd, "if [ \"$(docker inspect")).ToEqual(true)
+
+	err = (&instance{}).Run(action)
+	spec.ExpectString(err.Error()).ToContain("not configured")
+}
+
+func TestSshPlugin_cloneRepositoryKey(t *testing.T) {
+	spec := utilities.Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-ssh")
+	defer os.RemoveAll(dir)
+	tmp, bin, log := filepath.Join(dir, "tmp"), filepath.Join(dir, "bin"), filepath.Join(dir, "git.log")
+	os.MkdirAll(tmp, 0700)
+	os.MkdirAll(bin, 0700)
+	// git reads the key it is given through GIT_SSH_COMMAND
+	ioutil.WriteFile(filepath.Join(bin, "git"), []byte("#!/bin/sh\neval \"set -- $GIT_SSH_COMMAND\"\ncat \"$3\" >> "+log+"\n"), 0755)
+	keyFile := filepath.Join(dir, "deploy_key")
+	ioutil.WriteFile(keyFile, []byte("PRIVATE KEY\n"), 0600)
+
+	a := &plugins.Action{
+		Dest:       filepath.Join(dir, "data"),
+		Suffix:     "demo-dev",
+		Repository: &plugins.Repository{Ref: "master", Url: "ssh://git@github.com/aminjam/hipops-SAMOMY-backend.git", SshKey: keyFile},
+	}
+	var commands []string
+	run := func(cmd string, stdin []byte) error {
+		commands = append(commands, cmd)
+		sh := exec.Command("sh", "-c", cmd)
+		sh.Env = append(os.Environ(), "TMPDIR="+tmp, "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		sh.Stdin = bytes.NewReader(stdin)
+		sh.Run()
+		return nil
+	}
+	spec.Expect((&instance{}).cloneRepository(a, run)).ToEqual(nil)
+	spec.Expect(len(commands), strings.Contains(commands[0], "$(mktemp)")).ToEqual(1, true)
+	used, _ := ioutil.ReadFile(log)
+	spec.ExpectString(string(used)).ToContain("PRIVATE KEY")
+	left, _ := ioutil.ReadDir(tmp)
+	spec.Expect(len(left)).ToEqual(0)
+}
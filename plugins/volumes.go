@@ -0,0 +1,102 @@
+package plugins
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aminjam/hipops/utilities"
+)
+
+// Volume keeps an app's data outside its containers, in a named docker
+// volume or, when Path is set, in a directory of the host.
+type Volume struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Target string `json:"target"`
+	// BackupBeforeDeploy snapshots the volume into SnapshotDir before a
+	// container using it is replaced
+	BackupBeforeDeploy bool   `json:"backupBeforeDeploy,omitempty"`
+	SnapshotDir        string `json:"snapshotDir,omitempty"`
+	// Volume is the docker volume of a named volume, its name prefixed
+	// with the app's so that apps never share one by accident
+	Volume string `json:"volume,omitempty"`
+}
+
+// VolumeRestorer is implemented by the plugins that can bring a volume
+// snapshot back. An empty snapshot restores the latest one.
+type VolumeRestorer interface {
+	RestoreVolume(a *Action, v *Volume, snapshot string) error
+}
+
+// VolumeName matches the names docker accepts for a named volume.
+var VolumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// SNAPSHOT_TIME is the UTC time format of snapshot names.
+const SNAPSHOT_TIME = "20060102T150405Z"
+
+// Configure resolves a relative Path against the app dest, names the
+// docker volume after the app and explains what is wrong with the volume.
+func (v *Volume) Configure(app, dest, snapshotDir string) error {
+	if !VolumeName.MatchString(v.Name) {
+		return fmt.Errorf("%s name %q", utilities.INVALID_VOLUME, v.Name)
+	}
+	if !path.IsAbs(v.Target) {
+		return fmt.Errorf("%s %s: target %q is not an absolute path", utilities.INVALID_VOLUME, v.Name, v.Target)
+	}
+	if v.Path != "" && !path.IsAbs(v.Path) {
+		v.Path = path.Join(dest, v.Path)
+	}
+	v.Volume = ""
+	if v.Path == "" {
+		v.Volume = app + "_" + v.Name
+	}
+	v.SnapshotDir = snapshotDir
+	return nil
+}
+
+// Source is what docker mounts: the host path or the docker volume.
+func (v *Volume) Source() string {
+	if v.Path != "" {
+		return v.Path
+	}
+	return v.Volume
+}
+
+// SnapshotPrefix starts the name of every snapshot of the volume, which
+// goes on with the SNAPSHOT_TIME it was taken at and .tar.gz.
+func (v *Volume) SnapshotPrefix() string {
+	return v.Name + "-"
+}
+
+// Mount adds a -v flag for every volume to the container's params, unless
+// the params already mount its target, and keeps the volumes to snapshot
+// in Backup.
+func (c *Container) Mount(volumes []*Volume) error {
+	if len(volumes) == 0 {
+		return nil
+	}
+	p, err := ParseParams(c.Params)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Name, err)
+	}
+	flags := []string{}
+	for _, v := range volumes {
+		mounted := false
+		for _, existing := range p.Volumes {
+			parts := strings.Split(existing, ":")
+			mounted = mounted || (len(parts) > 1 && parts[1] == v.Target)
+		}
+		if !mounted {
+			flags = append(flags, "-v", v.Source()+":"+v.Target)
+		}
+		if v.BackupBeforeDeploy {
+			c.Backup = append(c.Backup, v)
+		}
+	}
+	if len(flags) != 0 {
+		c.Params = strings.Join(flags, " ") + " " + c.Params
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package utilities
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTarball_deterministic(t *testing.T) {
+	spec := Spec(t)
+	dir, _ := ioutil.TempDir("", "hipops-archive")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "src", "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "src", "lib", "lib.go"), []byte("package lib"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh"), 0755)
+
+	first := new(bytes.Buffer)
+	spec.Expect(Tarball(dir, first)).ToEqual(nil)
+	later := time.Now().Add(time.Hour)
+	filepath.Walk(dir, func(p string, _ os.FileInfo, _ error) error {
+		return os.Chtimes(p, later, later)
+	})
+	second := new(bytes.Buffer)
+	spec.Expect(Tarball(dir, second)).ToEqual(nil)
+	spec.Expect(bytes.Equal(first.Bytes(), second.Bytes())).ToEqual(true)
+
+	out, _ := ioutil.TempDir("", "hipops-archive")
+	defer os.RemoveAll(out)
+	spec.Expect(Untar(first, out)).ToEqual(nil)
+	info, err := os.Stat(filepath.Join(out, "run.sh"))
+	spec.Expect(err, info.Mode().Perm()).ToEqual(nil, os.FileMode(0755))
+}
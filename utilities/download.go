@@ -0,0 +1,251 @@
+package utilities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_DOWNLOAD_TIMEOUT  = 60 * time.Second
+	DEFAULT_DOWNLOAD_RETRIES  = 2
+	DEFAULT_DOWNLOAD_MAX_SIZE = 64 << 20
+)
+
+// retryDelay is the wait before the first retry; it doubles with every retry.
+var retryDelay = time.Second
+
+// Download describes a remote file. Zero values take the defaults, and so
+// does a nil Retries, so that 0 turns retries off.
+type Download struct {
+	Url, Sha256 string
+	Timeout     time.Duration
+	Retries     *int
+	MaxSize     int64
+}
+
+// validators tell whether a cached URL is still fresh: the sha256 of the
+// content and the ETag and Last-Modified the server sent with it.
+type validators struct {
+	Sum, ETag, LastModified string
+}
+
+// Cache is a content-addressed store of downloads shared by every run.
+// Files are kept as sha256/<digest>; urls/<digest of url> records the
+// digest a URL had when it was last fetched, with its validators.
+type Cache struct {
+	Dir string
+	// Offline only serves files that are already in the cache
+	Offline bool
+}
+
+// CacheDir is hipops/<name> in the user's cache directory, where state
+// shared by every run is kept.
+func CacheDir(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "hipops", name)
+}
+
+// Download fetches d into the cache, or into the workspace when it has none.
+func (w *Workspace) Download(d *Download) (string, error) {
+	if w == nil {
+		return "", errors.New(NO_WORKSPACE)
+	}
+	if w.Cache != nil {
+		return w.Cache.Fetch(d)
+	}
+	fetched, err := fetch(d, w.Dir, nil)
+	if err != nil {
+		return "", err
+	}
+	return fetched.fileName, nil
+}
+
+// Fetch returns the cached file for d. A download with a sha256 is only
+// fetched when it is not cached yet. One without is revalidated with the
+// server's ETag or Last-Modified and fetched again only when it changed,
+// or served from the cache without asking when the cache is offline.
+func (c *Cache) Fetch(d *Download) (string, error) {
+	if err := os.MkdirAll(c.path("urls"), 0700); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.path("sha256"), 0700); err != nil {
+		return "", err
+	}
+	sum := strings.ToLower(d.Sha256)
+	var cached *validators
+	if sum == "" {
+		cached = c.readIndex(d.Url)
+		if c.Offline {
+			if cached == nil {
+				return "", fmt.Errorf("%s %s", OFFLINE_NOT_CACHED, d.Url)
+			}
+			return c.path("sha256", cached.Sum), nil
+		}
+	} else if _, err := os.Stat(c.path("sha256", sum)); err == nil {
+		return c.path("sha256", sum), nil
+	}
+	if c.Offline {
+		return "", fmt.Errorf("%s %s", OFFLINE_NOT_CACHED, d.Url)
+	}
+	fetched, err := fetch(d, c.Dir, cached)
+	if err != nil {
+		return "", err
+	}
+	if fetched.fileName == "" {
+		return c.path("sha256", cached.Sum), nil
+	}
+	if err = os.Rename(fetched.fileName, c.path("sha256", fetched.Sum)); err != nil {
+		os.Remove(fetched.fileName)
+		return "", err
+	}
+	if err = c.writeIndex(d.Url, &fetched.validators); err != nil {
+		return "", err
+	}
+	return c.path("sha256", fetched.Sum), nil
+}
+
+// readIndex returns the validators recorded for url, nil when the URL or
+// its content is not cached.
+func (c *Cache) readIndex(url string) *validators {
+	content, err := ioutil.ReadFile(c.path("urls", digest(url)))
+	if err != nil {
+		return nil
+	}
+	lines := append(strings.Split(strings.TrimRight(string(content), "\n"), "\n"), "", "")
+	v := &validators{Sum: strings.TrimSpace(lines[0]), ETag: lines[1], LastModified: lines[2]}
+	if _, err := os.Stat(c.path("sha256", v.Sum)); v.Sum == "" || err != nil {
+		return nil
+	}
+	return v
+}
+
+func (c *Cache) writeIndex(url string, v *validators) error {
+	index, err := ioutil.TempFile(c.path("urls"), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(index, "%s\n%s\n%s\n", v.Sum, v.ETag, v.LastModified)
+	index.Close()
+	if err == nil {
+		err = os.Rename(index.Name(), c.path("urls", digest(url)))
+	}
+	if err != nil {
+		os.Remove(index.Name())
+	}
+	return err
+}
+
+func (c *Cache) path(elem ...string) string {
+	return filepath.Join(append([]string{c.Dir}, elem...)...)
+}
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetched is a downloaded file with the validators of its URL. fileName
+// is empty when the server answered that the cached copy is fresh.
+type fetched struct {
+	fileName string
+	validators
+}
+
+// fetch downloads d into a new 0600 file of dir, retrying network errors
+// and server errors. With cached validators, it asks the server whether
+// the cached copy changed first.
+func fetch(d *Download, dir string, cached *validators) (*fetched, error) {
+	retries := DEFAULT_DOWNLOAD_RETRIES
+	if d.Retries != nil {
+		retries = *d.Retries
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		f, retry, err := fetchOnce(d, dir, cached)
+		if err == nil || !retry || attempt >= retries {
+			return f, err
+		}
+		fmt.Printf("Retrying download of %s in %s: %s\n", d.Url, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func fetchOnce(d *Download, dir string, cached *validators) (f *fetched, retry bool, err error) {
+	timeout, maxSize := d.Timeout, d.MaxSize
+	if timeout == 0 {
+		timeout = DEFAULT_DOWNLOAD_TIMEOUT
+	}
+	if maxSize == 0 {
+		maxSize = DEFAULT_DOWNLOAD_MAX_SIZE
+	}
+	fmt.Println("Downloading file...", d.Url)
+	request, err := http.NewRequest("GET", d.Url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if cached != nil && cached.ETag != "" {
+		request.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached != nil && cached.LastModified != "" {
+		request.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	client := &http.Client{Timeout: timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, true, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		return &fetched{validators: *cached}, false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		retry = response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("downloading %s: %s", d.Url, response.Status)
+	}
+	if response.ContentLength > maxSize {
+		return nil, false, fmt.Errorf("%s %s (%d bytes, max %d)", DOWNLOAD_TOO_LARGE, d.Url, response.ContentLength, maxSize)
+	}
+
+	output, err := ioutil.TempFile(dir, "download-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		output.Close()
+		if err != nil {
+			os.Remove(output.Name())
+		}
+	}()
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(output, hash), io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if n > maxSize {
+		err = fmt.Errorf("%s %s (max %d bytes)", DOWNLOAD_TOO_LARGE, d.Url, maxSize)
+		return nil, false, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if d.Sha256 != "" && !strings.EqualFold(sum, d.Sha256) {
+		err = fmt.Errorf("%s %s (expected %s, got %s)", CHECKSUM_MISMATCH, d.Url, d.Sha256, sum)
+		return nil, false, err
+	}
+	return &fetched{fileName: output.Name(), validators: validators{
+		Sum:          sum,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}}, false, nil
+}
@@ -0,0 +1,101 @@
+package utilities
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	content     = "server {}"
+	otherSha256 = "2b8b5d6a4d4ae30e0ae4ac4f72c4b6f8bb1e8b4ed7e4e3b2c8fb0d8a5f2e1c3d"
+)
+
+func TestCache_Fetch(t *testing.T) {
+	spec := Spec(t)
+	retryDelay = 0
+	requests, failures := 0, 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case failures > 0:
+			failures--
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "hipops-cache")
+	defer os.RemoveAll(dir)
+	cache := &Cache{Dir: dir}
+
+	// the first request fails and is retried
+	fileName, err := cache.Fetch(&Download{Url: server.URL + "/nginx.conf"})
+	spec.Expect(err, requests).ToEqual(nil, 2)
+	got, _ := ioutil.ReadFile(fileName)
+	spec.Expect(string(got)).ToEqual(content)
+	sum := digest(content)
+	spec.Expect(fileName).ToEqual(cache.path("sha256", sum))
+
+	// a pinned download already in the cache is not fetched again
+	again, err := cache.Fetch(&Download{Url: server.URL + "/other.conf", Sha256: strings.ToUpper(sum)})
+	spec.Expect(err, again, requests).ToEqual(nil, fileName, 2)
+
+	_, err = cache.Fetch(&Download{Url: server.URL + "/nginx.conf", Sha256: otherSha256})
+	spec.ExpectString(err.Error()).ToContain(CHECKSUM_MISMATCH)
+	_, err = cache.Fetch(&Download{Url: server.URL + "/nginx.conf", MaxSize: 4})
+	spec.ExpectString(err.Error()).ToContain(DOWNLOAD_TOO_LARGE)
+	requests = 0
+	_, err = cache.Fetch(&Download{Url: server.URL + "/missing"})
+	spec.Expect(requests).ToEqual(1)
+	spec.ExpectString(err.Error()).ToContain("404")
+
+	offline := &Cache{Dir: dir, Offline: true}
+	requests = 0
+	cached, err := offline.Fetch(&Download{Url: server.URL + "/nginx.conf"})
+	spec.Expect(err, cached, requests).ToEqual(nil, fileName, 0)
+	_, err = offline.Fetch(&Download{Url: server.URL + "/new.conf"})
+	spec.ExpectString(err.Error()).ToContain(OFFLINE_NOT_CACHED)
+
+	info, _ := os.Stat(fileName)
+	spec.Expect(info.Mode().Perm()).ToEqual(os.FileMode(0600))
+}
+
+func TestCache_FetchRevalidates(t *testing.T) {
+	spec := Spec(t)
+	retryDelay = 0
+	var requests, downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/down":
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			downloads++
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "hipops-cache")
+	defer os.RemoveAll(dir)
+	cache := &Cache{Dir: dir}
+
+	first, err := cache.Fetch(&Download{Url: server.URL + "/nginx.conf"})
+	spec.Expect(err).ToEqual(nil)
+	second, err := cache.Fetch(&Download{Url: server.URL + "/nginx.conf"})
+	spec.Expect(err, second, requests, downloads).ToEqual(nil, first, 2, 1)
+
+	requests, none := 0, 0
+	_, err = cache.Fetch(&Download{Url: server.URL + "/down", Retries: &none})
+	spec.Expect(requests).ToEqual(1)
+	spec.ExpectString(err.Error()).ToContain("503")
+}
@@ -8,4 +8,20 @@ const (
 	INVALID_REPOSITORY    = "app repository has invalid format."
 	INVENTORY_MISSING     = "playbook inventory is missing."
 	UNKNOWN_CONTAINERS    = "playbook has no associated container."
+
+	INVALID_HOSTS             = "hosts need a group and every host a name or address."
+	UNDEFINED_INVENTORY_GROUP = "playbook inventory is not a group of hosts:"
+	UNKNOWN_HOST_FACT         = "unknown host fact"
+	NO_WORKSPACE              = "files can only be written or downloaded into a run workspace."
+	CHECKSUM_MISMATCH         = "sha256 does not match for"
+	DOWNLOAD_TOO_LARGE        = "download is too large:"
+	OFFLINE_NOT_CACHED        = "offline and not in the download cache:"
+	INVALID_FILE_MODE         = "customization mode is not an octal file mode:"
+	NO_CUSTOMIZATION_FILES    = "customization src has no files:"
+	UNKNOWN_BUILD_TAG         = "app build needs a tag or an image."
+	STALE_LOCK                = "scenario lock is stale:"
+	INVALID_REGISTRY          = "invalid registry:"
+	INVALID_NETWORK           = "invalid network:"
+	INVALID_VOLUME            = "invalid volume:"
+	UNRESOLVED_ADDR           = "unresolved addr:"
 )
@@ -0,0 +1,185 @@
+package utilities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DOCKER_HUB_REGISTRY = "registry-1.docker.io"
+	REGISTRY_TIMEOUT    = 30 * time.Second
+)
+
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var bearerParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ImageRef is an image split into its registry, repository and tag or
+// digest, as docker reads it.
+type ImageRef struct {
+	Registry, Repository, Tag, Digest string
+}
+
+// ParseImage reads image the way docker does: the first element is a
+// registry when it has a dot, a port or is localhost, images without one
+// come from Docker Hub, and the tag defaults to latest.
+func ParseImage(image string) *ImageRef {
+	ref := &ImageRef{Registry: DOCKER_HUB_REGISTRY}
+	if i := strings.Index(image, "@"); i != -1 {
+		image, ref.Digest = image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		image, ref.Tag = image[:i], image[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	if i := strings.Index(image, "/"); i != -1 && (strings.ContainsAny(image[:i], ".:") || image[:i] == "localhost") {
+		ref.Registry, image = image[:i], image[i+1:]
+	}
+	if ref.Registry == DOCKER_HUB_REGISTRY && !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	ref.Repository = image
+	return ref
+}
+
+// Name is the image without its tag or digest, as it was written.
+func (r *ImageRef) Name() string {
+	if r.Registry == DOCKER_HUB_REGISTRY {
+		return strings.TrimPrefix(r.Repository, "library/")
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// scheme is http for registries on the loopback, which docker also
+// trusts without TLS, and https for every other one.
+func (r *ImageRef) scheme() string {
+	host := r.Registry
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http"
+	}
+	return "https"
+}
+
+// RegistryLogin is who ImageDigest authenticates to the registry as.
+type RegistryLogin struct {
+	Username, Password string
+}
+
+// ImageDigest resolves the image's tag to the digest of its manifest
+// through the registry HTTP API, and returns the image pinned to it as
+// name@digest. Registries that want a token get one for login, or an
+// anonymous one when login is nil.
+func ImageDigest(image string, login *RegistryLogin) (string, error) {
+	ref := ParseImage(image)
+	if ref.Digest != "" {
+		return ref.Name() + "@" + ref.Digest, nil
+	}
+	client := &http.Client{Timeout: REGISTRY_TIMEOUT}
+	manifest := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", ref.scheme(), ref.Registry, ref.Repository, ref.Tag)
+	response, err := headManifest(client, manifest, "")
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		authorization, err := registryAuthorization(client, response.Header.Get("WWW-Authenticate"), login)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", image, err)
+		}
+		if response, err = headManifest(client, manifest, authorization); err != nil {
+			return "", err
+		}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry answered %s", image, response.Status)
+	}
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("%s: registry sent no Docker-Content-Digest", image)
+	}
+	return ref.Name() + "@" + digest, nil
+}
+
+func headManifest(client *http.Client, manifest, authorization string) (*http.Response, error) {
+	request, err := http.NewRequest("HEAD", manifest, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	return response, nil
+}
+
+// registryAuthorization answers the registry's challenge: Basic with the
+// login, or Bearer with a token the realm hands to the login or to anyone.
+func registryAuthorization(client *http.Client, challenge string, login *RegistryLogin) (string, error) {
+	switch {
+	case strings.HasPrefix(challenge, "Basic ") && login != nil:
+		return "Basic " + basicAuth(login), nil
+	case !strings.HasPrefix(challenge, "Bearer "):
+		return "", fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+	params := map[string]string{}
+	for _, m := range bearerParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	query := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			query.Set(k, params[k])
+		}
+	}
+	request, err := http.NewRequest("GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if login != nil {
+		request.Header.Set("Authorization", "Basic "+basicAuth(login))
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token: %s", response.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	return "Bearer " + body.Token, nil
+}
+
+func basicAuth(login *RegistryLogin) string {
+	return base64.StdEncoding.EncodeToString([]byte(login.Username + ":" + login.Password))
+}
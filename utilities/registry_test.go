@@ -0,0 +1,81 @@
+package utilities
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	spec := Spec(t)
+	for _, i := range []struct {
+		image, registry, repository, tag, name string
+	}{
+		{"mongo", DOCKER_HUB_REGISTRY, "library/mongo", "latest", "mongo"},
+		{"aminjam/mongodb:3.0", DOCKER_HUB_REGISTRY, "aminjam/mongodb", "3.0", "aminjam/mongodb"},
+		{"localhost:5000/team/api:v1", "localhost:5000", "team/api", "v1", "localhost:5000/team/api"},
+		{"quay.io/coreos/etcd", "quay.io", "coreos/etcd", "latest", "quay.io/coreos/etcd"},
+	} {
+		ref := ParseImage(i.image)
+		spec.Expect(ref.Registry, ref.Repository, ref.Tag, ref.Name()).ToEqual(i.registry, i.repository, i.tag, i.name)
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	spec := Spec(t)
+	const digest = "sha256:4f2b6a7c1d9e0a3b5c7d9e1f2a4b6c8d0e2f4a6b8c0d2e4f6a8b0c2d4e6f8a0b"
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token" && r.URL.Query().Get("scope") == "repository:aminjam/mongodb:pull":
+			fmt.Fprint(w, `{"token": "anonymous"}`)
+		case r.Header.Get("Authorization") != "Bearer anonymous":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="stand-in",scope="repository:aminjam/mongodb:pull"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == "HEAD" && r.URL.Path == "/v2/aminjam/mongodb/manifests/latest" && strings.Contains(r.Header.Get("Accept"), "manifest.list"):
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	pinned, err := ImageDigest(host+"/aminjam/mongodb", nil)
+	spec.Expect(err, pinned).ToEqual(nil, host+"/aminjam/mongodb@"+digest)
+	_, err = ImageDigest(host+"/aminjam/mongodb:missing", nil)
+	spec.ExpectString(err.Error()).ToContain("registry answered 404 Not Found")
+	pinned, err = ImageDigest("mongo@"+digest, nil)
+	spec.Expect(err, pinned).ToEqual(nil, "mongo@"+digest)
+}
+
+func TestImageDigest_Login(t *testing.T) {
+	spec := Spec(t)
+	const digest = "sha256:0b2d4f6a8c0e2b4d6f8a0c2e4b6d8f0a2c4e6b8d0f2a4c6e8b0d2f4a6c8e0b2d"
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		switch {
+		case r.URL.Path == "/token" && ok && user == "deploy" && password == "s3cret":
+			fmt.Fprint(w, `{"access_token": "deploy-token"}`)
+		case r.URL.Path == "/token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Header.Get("Authorization") != "Bearer deploy-token":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="stand-in",scope="repository:team/api:pull"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/team/api/manifests/v1":
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	pinned, err := ImageDigest(host+"/team/api:v1", &RegistryLogin{Username: "deploy", Password: "s3cret"})
+	spec.Expect(err, pinned).ToEqual(nil, host+"/team/api@"+digest)
+	_, err = ImageDigest(host+"/team/api:v1", nil)
+	spec.ExpectString(err.Error()).ToContain("registry token: 401 Unauthorized")
+}
@@ -10,12 +10,16 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	texttemplate "text/template"
 
 	"github.com/mitchellh/cli"
 )
 
 const (
 	DEFAULT_APP_STATE  = "running"
+	STOPPED_APP_STATE  = "stopped"
+	ABSENT_APP_STATE   = "absent"
+	REDEPLOY_APP_STATE = "deploying"
 	DEFAULT_APP_TYPE   = "generic"
 	DEFAULT_APP_BRANCH = "master"
 )
@@ -25,42 +29,57 @@ func CheckErr(err error) {
 	if err != nil {
 		msg := fmt.Sprintf("%s", err)
 		ui.Error(msg)
-		log.Fatalf(msg)
+		runExitHooks()
+		log.Fatal(msg)
 	}
 }
 func ParseTemplate(input string, base interface{}, app string) string {
-	t := template.New("")
+	output, _ := ExecuteTemplate(input, base, app, nil)
+	return output
+}
+
+// ExecuteTemplate is ParseTemplate with extra template functions, reporting
+// the errors ParseTemplate ignores.
+func ExecuteTemplate(input string, base interface{}, app string, funcs map[string]interface{}) (string, error) {
+	t := template.New("").Funcs(template.FuncMap(funcs))
 	if app != "" {
 		input = formatTemplate(input, app)
 	}
-	t, _ = t.Parse(input)
 	buf := new(bytes.Buffer)
-	t.Execute(buf, base)
-	return buf.String()
-}
-func RunCmd(name string, arg ...string) error {
-	fmt.Println("Running...", arg)
-	//return nil
-	cmd := exec.Command(name, arg...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stderr, err := cmd.StderrPipe()
+	t, err := t.Parse(input)
 	if err != nil {
-		return err
+		return "", err
 	}
-	err = cmd.Start()
+	err = t.Execute(buf, base)
+	return buf.String(), err
+}
+
+// RenderText executes a customization template as plain text, so its
+// output is written exactly as rendered instead of escaped for HTML.
+func RenderText(input string, data interface{}, funcs map[string]interface{}) (string, error) {
+	t, err := texttemplate.New("").Funcs(texttemplate.FuncMap(funcs)).Parse(input)
 	if err != nil {
-		return err
+		return "", err
 	}
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stderr, stderr)
-	err = cmd.Wait()
-	if err != nil {
-		return err
+	buf := new(bytes.Buffer)
+	err = t.Execute(buf, data)
+	return buf.String(), err
+}
+func RunCmd(name string, arg ...string) error {
+	return RunCmdOutput(os.Stdout, nil, name, arg...)
+}
+
+// RunCmdOutput runs the command with extra env vars, writing its stdout to
+// w. Stderr always goes to os.Stderr.
+func RunCmdOutput(w io.Writer, env []string, name string, arg ...string) error {
+	fmt.Println("Running...", arg)
+	cmd := exec.Command(name, arg...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
 	}
-	return nil
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
 func formatTemplate(input string, app string) string {
 	app = strings.Replace(app, "{{", "(", -1)
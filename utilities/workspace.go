@@ -0,0 +1,111 @@
+package utilities
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Workspace is the private directory of one run. Everything hipops writes
+// or downloads for the run goes there, readable by the current user only.
+type Workspace struct {
+	Dir, RunId string
+	// Cache keeps downloads across runs; without it they go to Dir
+	Cache *Cache
+	keep  bool
+	once  sync.Once
+}
+
+var (
+	exitMu    sync.Mutex
+	exitHooks []func()
+)
+
+// NewWorkspace creates the directory hipops-<run id> with 0700 in parent, or
+// in os.TempDir() when parent is empty. Unless keep is set, the directory is
+// removed by Remove or when CheckErr exits.
+func NewWorkspace(parent string, keep bool) (*Workspace, error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	parent = ExpandPath(parent)
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return nil, err
+	}
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	w := &Workspace{
+		RunId: fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(random)),
+		keep:  keep,
+	}
+	w.Dir = filepath.Join(parent, "hipops-"+w.RunId)
+	if err := os.Mkdir(w.Dir, 0700); err != nil {
+		return nil, err
+	}
+	exitMu.Lock()
+	exitHooks = append(exitHooks, func() { w.Remove() })
+	exitMu.Unlock()
+	return w, nil
+}
+
+// Path joins elem to the workspace directory.
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.Dir}, elem...)...)
+}
+
+// WriteFile writes content to a new file with 0600. The file name follows
+// pattern as in ioutil.TempFile, so repeated writes never collide.
+func (w *Workspace) WriteFile(pattern string, content []byte) (string, error) {
+	output, err := w.Create(pattern)
+	if err != nil {
+		return "", err
+	}
+	defer output.Close()
+	if _, err = output.Write(content); err != nil {
+		return "", err
+	}
+	return output.Name(), nil
+}
+
+// Create opens a new file with 0600 named after pattern as in
+// ioutil.TempFile.
+func (w *Workspace) Create(pattern string) (*os.File, error) {
+	if w == nil {
+		return nil, errors.New(NO_WORKSPACE)
+	}
+	return ioutil.TempFile(w.Dir, pattern)
+}
+
+// Remove deletes the workspace unless it is kept, in which case it tells
+// where it is.
+func (w *Workspace) Remove() error {
+	if w == nil {
+		return nil
+	}
+	var err error
+	w.once.Do(func() {
+		if w.keep {
+			fmt.Println("Keeping workspace", w.Dir)
+			return
+		}
+		err = os.RemoveAll(w.Dir)
+	})
+	return err
+}
+
+func runExitHooks() {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	for _, hook := range exitHooks {
+		hook()
+	}
+	exitHooks = nil
+}
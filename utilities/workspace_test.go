@@ -0,0 +1,44 @@
+package utilities
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	spec := Spec(t)
+	parent, _ := ioutil.TempDir("", "hipops-workdir")
+	defer os.RemoveAll(parent)
+
+	ws, err := NewWorkspace(parent, false)
+	spec.Expect(err).ToEqual(nil)
+	other, _ := NewWorkspace(parent, false)
+	spec.Expect(ws.Dir == other.Dir, filepath.Dir(ws.Dir)).ToEqual(false, parent)
+	info, _ := os.Stat(ws.Dir)
+	spec.Expect(info.Mode().Perm()).ToEqual(os.FileMode(0700))
+
+	first, err := ws.WriteFile("extra-vars-*.json", []byte(`{"password":"secret"}`))
+	spec.Expect(err).ToEqual(nil)
+	second, _ := ws.WriteFile("extra-vars-*.json", []byte(`{}`))
+	spec.Expect(first == second, filepath.Dir(first)).ToEqual(false, ws.Dir)
+	info, _ = os.Stat(first)
+	spec.Expect(info.Mode().Perm()).ToEqual(os.FileMode(0600))
+
+	// removing one run leaves the others alone
+	spec.Expect(ws.Remove()).ToEqual(nil)
+	_, err = os.Stat(ws.Dir)
+	spec.Expect(os.IsNotExist(err)).ToEqual(true)
+	_, err = os.Stat(other.Dir)
+	spec.Expect(err).ToEqual(nil)
+
+	kept, _ := NewWorkspace(parent, true)
+	spec.Expect(kept.Remove()).ToEqual(nil)
+	_, err = os.Stat(kept.Dir)
+	spec.Expect(err).ToEqual(nil)
+
+	var none *Workspace
+	_, err = none.WriteFile("x", nil)
+	spec.Expect(err.Error()).ToEqual(NO_WORKSPACE)
+}